@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const (
+	unvisited = iota
+	visiting
+	visited
+)
+
+// DepOrder returns rules along with everything they depend on, ordered
+// so every rule comes after its dependencies. A rule shows up at most
+// once, no matter how many other rules depend on it.
+func DepOrder(rcfile rcparse.RCFile, rules ...string) ([]string, error) {
+	state := map[string]int{}
+	order := []string{}
+	path := []string{}
+
+	var visit func(rule string, parent string) error
+	visit = func(rule string, parent string) error {
+		switch state[rule] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(slices.Clone(path[slices.Index(path, rule):]), rule)
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(cycle, " -> "))
+		}
+
+		deps, exists := rcfile.GetDeps(rule)
+		if !exists {
+			if parent == "" {
+				return fmt.Errorf("%w: %s", rcparse.ErrRuleNotFound, rule)
+			}
+			return fmt.Errorf("%w: %s (needed by %s)", rcparse.ErrRuleNotFound, rule, parent)
+		}
+
+		state[rule] = visiting
+		path = append(path, rule)
+		for _, dep := range deps {
+			if err := visit(dep, rule); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[rule] = visited
+
+		order = append(order, rule)
+		return nil
+	}
+
+	for _, rule := range rules {
+		if err := visit(rule, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
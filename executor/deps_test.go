@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const DEPSFILE = `
+wf_file:
+  - rule: build
+    c:
+     - echo build
+  - rule: gen
+    c:
+     - echo gen
+  - rule: test
+    deps: [build, gen]
+    c:
+     - echo test
+  - rule: check
+    deps: [gen]
+    c:
+     - echo check
+  - rule: all
+    deps: [test, check, build]
+  - rule: loop1
+    deps: [loop2]
+  - rule: loop2
+    deps: [loop3]
+  - rule: loop3
+    deps: [loop1]
+  - rule: broken
+    deps: [missing]
+`
+
+func TestDepOrder(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(DEPSFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:  "no deps",
+			rules: []string{"build"},
+			want:  []string{"build"},
+		},
+		{
+			name:  "simple",
+			rules: []string{"test"},
+			want:  []string{"build", "gen", "test"},
+		},
+		{
+			name:  "diamond",
+			rules: []string{"all"},
+			want:  []string{"build", "gen", "test", "check", "all"},
+		},
+		{
+			name:  "several rules share deps",
+			rules: []string{"check", "test"},
+			want:  []string{"gen", "check", "build", "test"},
+		},
+		{
+			name:    "cycle",
+			rules:   []string{"loop1"},
+			wantErr: "dependency cycle: loop1 -> loop2 -> loop3 -> loop1",
+		},
+		{
+			name:    "missing dep",
+			rules:   []string{"broken"},
+			wantErr: "rule not found: missing (needed by broken)",
+		},
+		{
+			name:    "missing rule",
+			rules:   []string{"nope"},
+			wantErr: "rule not found: nope",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DepOrder(rcfile, tt.rules...)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("DepOrder() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("DepOrder() unexpected error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DepOrder() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// buildEnv makes the environment for a command. Depending on mode it
+// starts from all, none, or the variables in pass of wf's own
+// environment, and env is then added on top.
+func buildEnv(mode string, pass []string, env map[string]string) []string {
+	rv := []string{}
+
+	switch mode {
+	case rcparse.EnvClean:
+	case rcparse.EnvAllowlist:
+		for _, kv := range os.Environ() {
+			k, _, _ := strings.Cut(kv, "=")
+			if slices.Contains(pass, k) {
+				rv = append(rv, kv)
+			}
+		}
+	default:
+		rv = append(rv, os.Environ()...)
+	}
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rv = append(rv, fmt.Sprintf("%s=%s", k, env[k]))
+	}
+
+	// exec keeps the last of any duplicates, so the rule's env wins
+	return rv
+}
+
+// Environ returns the environment the commands of rule get: what its
+// env_mode and env_pass pass on of wf's own, with its dotenv files and
+// env added.
+func Environ(rcfile rcparse.RCFile, rule string) (map[string]string, error) {
+	_, env, err := rcfile.CommandEnv(rule)
+	if err != nil {
+		return nil, err
+	}
+	r, _ := rcfile.GetRule(rule)
+
+	rv := map[string]string{}
+	for _, kv := range buildEnv(r.EnvMode, r.EnvPass, env) {
+		k, v, _ := strings.Cut(kv, "=")
+		rv[k] = v
+	}
+	return rv, nil
+}
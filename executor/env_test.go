@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// lookupEnv finds key in env the way exec does, with the last one winning.
+func lookupEnv(env []string, key string) (string, bool) {
+	val, found := "", false
+	for _, kv := range env {
+		if k, v, _ := strings.Cut(kv, "="); k == key {
+			val, found = v, true
+		}
+	}
+	return val, found
+}
+
+func Test_buildEnv(t *testing.T) {
+	t.Setenv("WF_TEST_KEEP", "keep")
+	t.Setenv("WF_TEST_DROP", "drop")
+
+	tests := []struct {
+		name    string
+		mode    string
+		pass    []string
+		env     map[string]string
+		want    map[string]string
+		notWant []string
+	}{
+		{
+			name: "inherit",
+			mode: rcparse.EnvInherit,
+			env:  map[string]string{"FOO": "BAR"},
+			want: map[string]string{"WF_TEST_KEEP": "keep", "WF_TEST_DROP": "drop", "FOO": "BAR"},
+		},
+		{
+			name: "inherit without env",
+			mode: rcparse.EnvInherit,
+			want: map[string]string{"WF_TEST_KEEP": "keep", "WF_TEST_DROP": "drop"},
+		},
+		{
+			name: "rule env wins",
+			mode: rcparse.EnvInherit,
+			env:  map[string]string{"WF_TEST_KEEP": "changed"},
+			want: map[string]string{"WF_TEST_KEEP": "changed"},
+		},
+		{
+			name:    "clean",
+			mode:    rcparse.EnvClean,
+			env:     map[string]string{"FOO": "BAR"},
+			want:    map[string]string{"FOO": "BAR"},
+			notWant: []string{"WF_TEST_KEEP", "WF_TEST_DROP", "PATH"},
+		},
+		{
+			name:    "allowlist",
+			mode:    rcparse.EnvAllowlist,
+			pass:    []string{"WF_TEST_KEEP"},
+			env:     map[string]string{"FOO": "BAR"},
+			want:    map[string]string{"WF_TEST_KEEP": "keep", "FOO": "BAR"},
+			notWant: []string{"WF_TEST_DROP"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildEnv(tt.mode, tt.pass, tt.env)
+			if got == nil {
+				t.Errorf("buildEnv() is nil, which exec takes as inheriting everything")
+			}
+			for k, want := range tt.want {
+				if v, ok := lookupEnv(got, k); !ok || v != want {
+					t.Errorf("buildEnv() %s = %q, want %q", k, v, want)
+				}
+			}
+			for _, k := range tt.notWant {
+				if _, ok := lookupEnv(got, k); ok {
+					t.Errorf("buildEnv() has %s", k)
+				}
+			}
+		})
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("WF_TEST_KEEP", "keep")
+	t.Setenv("WF_TEST_DROP", "drop")
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("FROM_DOTENV=yes\nFOO=dotenv\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".workflow.yaml"), []byte(`
+env:
+  TOP: top
+wf_file:
+  - rule: inherit
+    dotenv: [.env]
+    env: {FOO: rule}
+    c: [env]
+  - rule: allowlist
+    env_mode: allowlist
+    env_pass: [WF_TEST_KEEP]
+    c: [env]
+  - rule: clean
+    env_mode: clean
+    c: [env]
+`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rcfile, err := rcparse.NewYRCFile(filepath.Join(dir, ".workflow.yaml"))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    map[string]string
+		notWant []string
+		wantErr bool
+	}{
+		{
+			name: "inherit",
+			rule: "inherit",
+			want: map[string]string{"WF_TEST_KEEP": "keep", "TOP": "top", "FROM_DOTENV": "yes", "FOO": "rule"},
+		},
+		{
+			name:    "allowlist",
+			rule:    "allowlist",
+			want:    map[string]string{"WF_TEST_KEEP": "keep", "TOP": "top"},
+			notWant: []string{"WF_TEST_DROP", "PATH"},
+		},
+		{
+			name:    "clean",
+			rule:    "clean",
+			want:    map[string]string{"TOP": "top"},
+			notWant: []string{"WF_TEST_KEEP", "PATH"},
+		},
+		{
+			name:    "no such rule",
+			rule:    "nothere",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Environ(rcfile, tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Environ() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("Environ() %s = %q, want %q", k, got[k], v)
+				}
+			}
+			for _, k := range tt.notWant {
+				if _, found := got[k]; found {
+					t.Errorf("Environ() has %s", k)
+				}
+			}
+		})
+	}
+}
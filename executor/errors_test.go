@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const ErrorsFile = `
+wf_file:
+  - rule: fails
+    c:
+      - sh -c "exit 3"
+  - rule: nocmd
+    c:
+      - wf-no-such-command
+  - rule: badtmpl
+    c:
+      - echo ok
+      - echo {{.Nope
+  - rule: baddep
+    deps: [missing]
+    c:
+      - echo ok
+`
+
+func TestLocalExecutor_RunErrors(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(ErrorsFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rule   string
+		want   int
+		target error
+		check  func(error) bool
+	}{
+		{
+			name: "exit code",
+			rule: "fails",
+			want: 3,
+			check: func(err error) bool {
+				var e *ExitError
+				return errors.As(err, &e) && e.Code == 3
+			},
+		},
+		{
+			name:   "command not found",
+			rule:   "nocmd",
+			want:   -1,
+			target: ErrCommandNotFound,
+		},
+		{
+			name: "template",
+			rule: "badtmpl",
+			want: -1,
+			check: func(err error) bool {
+				var e *rcparse.TemplateError
+				return errors.As(err, &e) && e.Rule == "badtmpl" && e.Line == 2
+			},
+		},
+		{
+			name:   "rule not found",
+			rule:   "nope",
+			want:   -1,
+			target: rcparse.ErrRuleNotFound,
+		},
+		{
+			name:   "dependency not found",
+			rule:   "baddep",
+			want:   -1,
+			target: rcparse.ErrRuleNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LocalExecutor{name: "test"}
+			got, err := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("Run() error = %v, want %v", err, tt.target)
+			}
+			if tt.check != nil && !tt.check(err) {
+				t.Errorf("Run() error = %v of the wrong kind", err)
+			}
+		})
+	}
+}
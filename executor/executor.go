@@ -12,26 +12,41 @@
 // Package executor is the system of executing a command.
 // This is an interface to allow for other forms of execution,
 // i.e. remote, maybe in a docker, etc.
+//
+// Other executors are registered by name with Register, usually from the
+// init function of a package built into wf, and picked by a rule with
+// executor: <name>.
 package executor
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/stillson/go-wf/rcparse"
 	"github.com/stillson/go-wf/termui"
 )
 
 // This is tricky to test. Depends on hidden variable and file system.
-func preProcCmd(cmd string) (string, []string, error) {
+func preProcCmd(cmd string, opts rcparse.WordOpts) (string, []string, error) {
 
-	cmdStart, cmdRest, err := rcparse.ParseCmd(cmd)
+	cmdStart, cmdRest, err := rcparse.ParseCmdWith(cmd, opts)
 	if err != nil {
 		return "", nil, err
 	}
 
 	outCmd, err := exec.LookPath(cmdStart)
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return cmdStart, cmdRest, fmt.Errorf("%w: %s", ErrCommandNotFound, cmdStart)
+	}
 	if err != nil {
 		return cmdStart, cmdRest, err
 	}
@@ -39,30 +54,186 @@ func preProcCmd(cmd string) (string, []string, error) {
 	return outCmd, cmdRest, nil
 }
 
+// Executor runs a rule from rcfile, after first running everything it
+// depends on, and returns the exit code of what failed, if anything did.
 type Executor interface {
-	Run(rule string, rcfile *rcparse.RCFile) (int, error)
-	// RunWithContext(ctx context.Context, rule string, rcfile *rcparse.RCFile) error
+	Run(rule string, rcfile rcparse.RCFile) (int, error)
+	RunWithContext(ctx context.Context, rule string, rcfile rcparse.RCFile) (int, error)
 }
 
+var _ Executor = (*LocalExecutor)(nil)
+
+// DefaultGracePeriod is how long a cancelled command has to exit before
+// it is killed.
+const DefaultGracePeriod = 5 * time.Second
+
 type LocalExecutor struct {
-	name string
+	name   string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// rule holds the settings of the rule being run.
+	rule rcparse.CmdEnv
+
+	// GracePeriod is how long a command has to exit after being passed
+	// the signal that cancelled it, before it gets SIGKILL.
+	GracePeriod time.Duration
+
+	// Verbose explains why rules with sources or generates are run or
+	// skipped.
+	Verbose bool
 }
 
 func NewLocalExec(name string) LocalExecutor {
-	return LocalExecutor{name}
+	return LocalExecutor{
+		name:        name,
+		stdin:       os.Stdin,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		GracePeriod: DefaultGracePeriod,
+	}
 }
 
-func (l *LocalExecutor) Run(rule string, rcfile *rcparse.YRCfile) (int, error) {
+// Run runs rule, after first running everything it depends on.
+// Each dependency is run at most once.
+func (l *LocalExecutor) Run(rule string, rcfile rcparse.RCFile) (int, error) {
+	return l.RunWithContext(context.Background(), rule, rcfile)
+}
+
+// RunWithContext is Run, but stops when ctx is cancelled. The running
+// command is sent the signal that cancelled ctx (SIGTERM if it wasn't a
+// signal), and is killed if it hasn't exited after the grace period.
+// No further commands are started.
+func (l *LocalExecutor) RunWithContext(ctx context.Context, rule string, rcfile rcparse.RCFile) (int, error) {
+	return l.RunRules(ctx, []string{rule}, rcfile, 1)
+}
+
+// outputs returns where the output of commands goes.
+func (l *LocalExecutor) outputs() (io.Writer, io.Writer) {
+	stdout, stderr := l.stdout, l.stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	return stdout, stderr
+}
+
+func (l *LocalExecutor) grace() time.Duration {
+	if l.GracePeriod <= 0 {
+		return DefaultGracePeriod
+	}
+	return l.GracePeriod
+}
+
+func (l *LocalExecutor) runRule(ctx context.Context, rule string, rcfile rcparse.RCFile) (int, error) {
+	cmd, env, err := rcfile.CommandEnv(rule)
+	if err != nil {
+		return -1, err
+	}
+
+	r, _ := rcfile.GetRule(rule)
+
+	var check freshness
+	if len(r.Sources) > 0 || len(r.Generates) > 0 {
+		check, err = checkUpToDate(rule, r, cmd, rcfile.GetArgs(rule))
+		if err != nil {
+			return -1, err
+		}
+		if !l.needsRun(rule, check) {
+			return 0, nil
+		}
+	}
+
+	rv, _, err := l.withHooks(ctx, rcfile, rule, func() (int, string, error) {
+		rv, err := l.runCommands(ctx, rule, r, cmd, env, rcfile)
+		return rv, rule, err
+	})
+	if (err != nil || rv != 0) && r.ContinueOnError && ctx.Err() == nil {
+		l.warn("rule %s failed, continuing: %v", rule, failure(rv, err))
+		return 0, nil
+	}
+	if err == nil && rv == 0 && check.sum != "" {
+		if err := saveChecksum(r.Dir, rule, check.sum); err != nil {
+			return -1, fmt.Errorf("rule %s: saving checksum: %w", rule, err)
+		}
+	}
+	return rv, err
+}
+
+// warn reports a failure that doesn't stop anything.
+func (l *LocalExecutor) warn(format string, a ...any) {
 	red, _ := termui.GetColorPrints()
+	stdout, _ := l.outputs()
+	_, _ = red.Fprintf(stdout, format+"\n", a...)
+}
+
+// failure is the error for a command or rule that returned rv and err.
+func failure(rv int, err error) error {
+	if err == nil {
+		return &ExitError{Code: rv}
+	}
+	return err
+}
+
+// needsRun reports whether rule needs to run, saying so when it doesn't,
+// and why in verbose mode.
+func (l *LocalExecutor) needsRun(rule string, check freshness) bool {
+	_, green := termui.GetColorPrints()
+	stdout, _ := l.outputs()
+
+	switch {
+	case check.skip && l.Verbose:
+		_, _ = green.Fprintf(stdout, "rule %s is up to date: %s\n", rule, check.reason)
+	case check.skip:
+		_, _ = green.Fprintf(stdout, "rule %s is up to date\n", rule)
+	case l.Verbose:
+		_, _ = green.Fprintf(stdout, "rule %s is out of date: %s\n", rule, check.reason)
+	}
+	return !check.skip
+}
 
-	cmd, env, exists := rcfile.GetCommandEnv(rule)
-	if !exists {
-		_, _ = red.Printf("rule does not exist\n")
-		os.Exit(3)
+// runCommands runs the commands of rule r, already templated as cmd.
+func (l *LocalExecutor) runCommands(ctx context.Context, rule string, r rcparse.CmdEnv, cmd []string,
+	env map[string]string, rcfile rcparse.RCFile) (int, error) {
+	run := *l
+	run.rule = r
+
+	ctx, cancel := withTimeout(ctx, r.Timeout, "rule "+rule)
+	defer cancel()
+
+	if r.Executor != "" && r.Executor != Local {
+		return runElsewhere(ctx, r.Executor, rule, rcfile)
+	}
+
+	var extra []string
+	if r.Passthrough {
+		extra = rcfile.GetArgs(rule)
 	}
 
-	for _, c := range cmd {
-		rv, err := l.subRun(c, env)
+	return run.runList(ctx, cmd, env, extra)
+}
+
+// runList runs cmd, the commands of l.rule, in order, stopping at the
+// first that fails and doesn't have its error ignored.
+func (l *LocalExecutor) runList(ctx context.Context, cmd []string, env map[string]string, extra []string) (int, error) {
+	for i, c := range cmd {
+		if ctx.Err() != nil {
+			return ctxError(ctx)
+		}
+
+		var opts rcparse.CmdOpts
+		if i < len(l.rule.Opts) {
+			opts = l.rule.Opts[i]
+		}
+
+		rv, err := l.runRetrying(ctx, c, opts, env, extra)
+		if (err != nil || rv != 0) && opts.IgnoreError && ctx.Err() == nil {
+			l.warn("%v, ignored", failure(rv, err))
+			continue
+		}
 		if err != nil || rv != 0 {
 			return rv, err
 		}
@@ -71,39 +242,239 @@ func (l *LocalExecutor) Run(rule string, rcfile *rcparse.YRCfile) (int, error) {
 	return 0, nil
 }
 
-func (l *LocalExecutor) subRun(cmd string, env map[string]string) (int, error) {
-	red, _ := termui.GetColorPrints()
-	splitCmd, splitArgs, err := preProcCmd(cmd)
+// subRun runs a single command, with extra appended to its arguments.
+func (l *LocalExecutor) subRun(ctx context.Context, cmd string, env map[string]string, extra []string) (int, error) {
+	splitCmd, splitArgs, err := l.commandLine(cmd, env, extra)
+	if err != nil {
+		return -1, err
+	}
+
+	return l.execute(ctx, splitCmd, splitArgs, env)
+}
+
+// runScript writes script to a temporary file and runs it, with extra as
+// its arguments. It is run by the rule's interpreter if it has one, else
+// by the interpreter on its #! line, else by sh.
+func (l *LocalExecutor) runScript(ctx context.Context, script string, env map[string]string, extra []string) (int, error) {
+	f, err := os.CreateTemp("", "wf-script-*")
+	if err != nil {
+		return -1, fmt.Errorf("writing script: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	_, err = f.WriteString(script)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		_, _ = red.Printf("cmd not found in path? %v\terr:%v\n", splitCmd, err)
-		os.Exit(4)
+		return -1, fmt.Errorf("writing script: %w", err)
+	}
+
+	// The script is always handed to its interpreter rather than run
+	// itself, so it works from a noexec $TMPDIR and can't be caught
+	// open for writing by a command forked meanwhile (ETXTBSY).
+	interpreter, arg := l.rule.Interpreter, ""
+	if interpreter == "" {
+		interpreter = "sh"
+		if first, _, _ := strings.Cut(script, "\n"); strings.HasPrefix(first, "#!") {
+			// like the kernel, everything after the path is one argument
+			interpreter, arg, _ = strings.Cut(strings.TrimSpace(first[2:]), " ")
+			arg = strings.TrimSpace(arg)
+		}
 	}
 
+	splitCmd, splitArgs, err := preProcCmd(interpreter, rcparse.WordOpts{})
+	if err != nil {
+		return -1, fmt.Errorf("interpreter %s: %w", interpreter, err)
+	}
+	if arg != "" {
+		splitArgs = append(splitArgs, arg)
+	}
+	splitArgs = append(splitArgs, f.Name())
+	splitArgs = append(splitArgs, extra...)
+
+	return l.execute(ctx, splitCmd, splitArgs, env)
+}
+
+// execute runs splitCmd with splitArgs, and returns its exit code.
+func (l *LocalExecutor) execute(ctx context.Context, splitCmd string, splitArgs []string, env map[string]string) (int, error) {
 	l.displayCommand(splitCmd, splitArgs, env)
 
 	ecmd := l.getCommand(splitCmd, splitArgs, env)
-	err = ecmd.Run()
+	if l.rule.Stdin != "" {
+		stdin := l.rule.Stdin
+		if !filepath.IsAbs(stdin) {
+			stdin = filepath.Join(l.rule.Dir, stdin)
+		}
+		in, err := os.Open(stdin) //nolint:gosec
+		if err != nil {
+			return -1, fmt.Errorf("stdin for %s: %w", splitCmd, err)
+		}
+		defer func() {
+			_ = in.Close()
+		}()
+		ecmd.Stdin = in
+	}
 
+	var err error
+	if l.rule.TTY {
+		err = l.runTTY(ctx, ecmd)
+	} else {
+		err = l.runCommand(ctx, ecmd)
+	}
+
+	if ctx.Err() != nil {
+		return ctxError(ctx)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if sig, ok := signalOf(exitErr.ProcessState); ok {
+			code := 128 + int(sig)
+			return code, fmt.Errorf("command %s: %w", splitCmd, &ExitError{Code: code, Signal: sig})
+		}
+		if exitErr.ExitCode() > 0 {
+			return exitErr.ExitCode(), fmt.Errorf("command %s: %w", splitCmd, &ExitError{Code: exitErr.ExitCode()})
+		}
+	}
 	if err != nil {
-		return -1, fmt.Errorf("error running command %s: %v", splitCmd, err)
+		return -1, fmt.Errorf("error running command %s: %w", splitCmd, err)
 	}
 	return ecmd.ProcessState.ExitCode(), nil
 }
 
+// commandLine turns cmd into the program to run and its arguments, either
+// by splitting it up or by handing it whole to the rule's shell. Extra
+// arguments are appended, or given to the shell as "$@".
+//
+// Variables in a command that is split up are looked up in the
+// environment it will be run with.
+func (l *LocalExecutor) commandLine(cmd string, env map[string]string, extra []string) (string, []string, error) {
+	if l.rule.Shell == "" || l.rule.Shell == rcparse.NoShell {
+		vars := map[string]string{}
+		for _, kv := range buildEnv(l.rule.EnvMode, l.rule.EnvPass, env) {
+			k, v, _ := strings.Cut(kv, "=")
+			vars[k] = v
+		}
+		opts := rcparse.WordOpts{
+			Lookup: func(k string) (string, bool) {
+				v, ok := vars[k]
+				return v, ok
+			},
+			Tilde: l.rule.Tilde,
+			Glob:  l.rule.Glob,
+		}
+		splitCmd, splitArgs, err := preProcCmd(cmd, opts)
+		return splitCmd, append(splitArgs, extra...), err
+	}
+
+	shell, shellArgs, err := preProcCmd(l.rule.Shell, rcparse.WordOpts{})
+	if err != nil {
+		return shell, nil, err
+	}
+	shellArgs = append(shellArgs, cmd)
+	if len(extra) > 0 {
+		shellArgs = append(shellArgs, "wf")
+		shellArgs = append(shellArgs, extra...)
+	}
+	return shell, shellArgs, nil
+}
+
+// runCommand runs ecmd in a process group of its own. If ctx is cancelled
+// first, the group is sent the cancelling signal, and anything left in it
+// once the grace period is up gets SIGKILL.
+//
+// A command reading from the terminal wf is in the foreground of stays in
+// wf's process group instead, so it can read input, and Ctrl-C reaches
+// both it and wf. Only the command itself is signalled then. A command
+// that Ctrl-C or Ctrl-\ stopped interrupts the whole run, see interrupt.
+func (l *LocalExecutor) runCommand(ctx context.Context, ecmd *exec.Cmd) error {
+	var sigs chan os.Signal
+	if in, ok := ecmd.Stdin.(*os.File); ok && ownsTerminal(in) {
+		sigs = make(chan os.Signal, 1)
+		notifyInterrupt(sigs)
+		defer signal.Stop(sigs)
+	} else {
+		setProcGroup(ecmd)
+	}
+
+	if err := ecmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	kill, alive := signalGroup, groupAlive
+	if sigs != nil {
+		kill = func(ecmd *exec.Cmd, sig os.Signal) error {
+			return ecmd.Process.Signal(sig)
+		}
+		alive = func(*exec.Cmd) bool {
+			select {
+			case <-done:
+				return false
+			default:
+				return true
+			}
+		}
+	}
+
+	cleaned := make(chan struct{})
+	go func() {
+		defer close(cleaned)
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+
+		_ = kill(ecmd, cancelSignal(ctx))
+
+		deadline := time.After(l.grace())
+		tick := time.NewTicker(50 * time.Millisecond)
+		defer tick.Stop()
+		for alive(ecmd) {
+			select {
+			case <-deadline:
+				_ = kill(ecmd, os.Kill)
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+
+	err := ecmd.Wait()
+	close(done)
+	<-cleaned
+
+	select {
+	case sig := <-sigs:
+		interrupt(ctx, sig)
+	default:
+	}
+	if sig, ok := interruptedBy(ecmd.ProcessState); ok {
+		interrupt(ctx, sig)
+	}
+	return err
+}
+
 func (l *LocalExecutor) displayCommand(splitCmd string, splitArgs []string, env map[string]string) {
 	_, green := termui.GetColorPrints()
-	_, _ = green.Printf("cmd: %v\t\targs: %#v\n", splitCmd, splitArgs)
+	stdout, _ := l.outputs()
+	_, _ = green.Fprintf(stdout, "cmd: %v\t\targs: %#v\n", splitCmd, splitArgs)
 	if env != nil {
-		_, _ = green.Printf("Env : %+v\n", env)
+		_, _ = green.Fprintf(stdout, "Env : %+v\n", env)
 	}
-	fmt.Printf("\n")
+	_, _ = fmt.Fprintf(stdout, "\n")
 }
 
 func (l *LocalExecutor) getCommand(splitCmd string, splitArgs []string, env map[string]string) *exec.Cmd {
 	ecmd := exec.Command(splitCmd, splitArgs...) //nolint:gosec
-	ecmd.Stdout, ecmd.Stderr = os.Stdout, os.Stderr
-	for k, v := range env {
-		ecmd.Env = append(ecmd.Env, fmt.Sprintf("%s=%s", k, v))
+	ecmd.Stdout, ecmd.Stderr = l.outputs()
+	if l.stdin != nil {
+		ecmd.Stdin = l.stdin
 	}
+	ecmd.Env = buildEnv(l.rule.EnvMode, l.rule.EnvPass, env)
+	ecmd.Dir = l.rule.Dir
 	return ecmd
 }
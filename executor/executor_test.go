@@ -12,10 +12,13 @@
 package executor
 
 import (
+	"bytes"
+	"context"
 	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/fatih/color"
 	"github.com/stillson/go-wf/rcparse"
 )
 
@@ -27,6 +30,21 @@ wf_file:
     rule: alpha
     c:
      - echo "TEST"
+  -
+    rule: beta
+    deps: [alpha]
+    c:
+     - echo "BETA"
+  -
+    rule: passthru
+    passthrough: true
+    c:
+     - test PASS =
+  -
+    rule: gamma
+    deps: [gamma]
+    c:
+     - echo "GAMMA"
 `
 
 func TestLocalExecutor_Run(t *testing.T) {
@@ -37,6 +55,7 @@ func TestLocalExecutor_Run(t *testing.T) {
 	}
 
 	rcfile, _ := rcparse.CreateYRCFile(strings.NewReader(YAMLFILE))
+	_ = rcfile.SetArgs("passthru", []string{"PASS"})
 
 	tests := []struct {
 		name    string
@@ -55,6 +74,36 @@ func TestLocalExecutor_Run(t *testing.T) {
 			want:    0,
 			wantErr: false,
 		},
+		{
+			name:   "deps",
+			fields: "test",
+			args: args{
+				rule:   "beta",
+				rcfile: rcfile,
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:   "passthrough",
+			fields: "test",
+			args: args{
+				rule:   "passthru",
+				rcfile: rcfile,
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:   "cycle",
+			fields: "test",
+			args: args{
+				rule:   "gamma",
+				rcfile: rcfile,
+			},
+			want:    -1,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -142,8 +191,9 @@ func TestLocalExecutor_getCommand(t *testing.T) {
 
 func TestLocalExecutor_subRun(t *testing.T) {
 	type args struct {
-		cmd string
-		env map[string]string
+		cmd   string
+		env   map[string]string
+		extra []string
 	}
 	tests := []struct {
 		name    string
@@ -163,13 +213,35 @@ func TestLocalExecutor_subRun(t *testing.T) {
 			want:    0,
 			wantErr: false,
 		},
+		{
+			name:   "extra args",
+			fields: "test",
+			args: args{
+				cmd:   "test a =",
+				env:   map[string]string{"TEST": "TEST"},
+				extra: []string{"a"},
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:   "extra args mismatch",
+			fields: "test",
+			args: args{
+				cmd:   "test a =",
+				env:   map[string]string{"TEST": "TEST"},
+				extra: []string{"b"},
+			},
+			want:    1,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			l := &LocalExecutor{
 				name: tt.fields,
 			}
-			got, err := l.subRun(tt.args.cmd, tt.args.env)
+			got, err := l.subRun(context.Background(), tt.args.cmd, tt.args.env, tt.args.extra)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("subRun() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -199,7 +271,7 @@ func Test_preProcCmd(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := preProcCmd(tt.args)
+			got, got1, err := preProcCmd(tt.args, rcparse.WordOpts{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("preProcCmd() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -213,3 +285,192 @@ func Test_preProcCmd(t *testing.T) {
 		})
 	}
 }
+
+const ShellFile = `
+shell: sh -c
+wf_file:
+  - rule: pipe
+    c:
+      - echo hi | grep -q hi && test -n "$HOME"
+  - rule: args
+    passthrough: true
+    c:
+      - test "$1" = one && test "$#" = 2
+  - rule: ownshell
+    shell: sh -ec
+    c:
+      - "false; true"
+  - rule: direct
+    shell: none
+    c:
+      - test "a|b" = "a|b"
+  - rule: expand
+    shell: none
+    tilde: true
+    env:
+      WHO: wf
+    c:
+      - test "$WHO-${UNSET:-x}" = wf-x
+      - test ~ = "$HOME"
+`
+
+func TestLocalExecutor_Shell(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(ShellFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+	_ = rcfile.SetArgs("args", []string{"one", "two"})
+
+	tests := []struct {
+		name string
+		rule string
+		want int
+	}{
+		{name: "pipes and &&", rule: "pipe", want: 0},
+		{name: "args as $@", rule: "args", want: 0},
+		{name: "rule shell wins", rule: "ownshell", want: 1},
+		{name: "none runs directly", rule: "direct", want: 0},
+		{name: "expansions", rule: "expand", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LocalExecutor{name: "test"}
+			got, _ := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const ScriptFile = `
+vars:
+  n: "3"
+wf_file:
+  - rule: loop
+    script: |
+      i=0
+      while [ $i -lt {{.V.n}} ]; do i=$((i+1)); done
+      test $i = 3
+  - rule: interp
+    interpreter: sh -e
+    script: |
+      false
+      true
+  - rule: shebang
+    passthrough: true
+    script: |
+      #!/bin/sh
+      test "$1" = one
+  - rule: shebangarg
+    script: |
+      #!/bin/sh -e
+      false
+      true
+`
+
+func TestLocalExecutor_Script(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(ScriptFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+	_ = rcfile.SetArgs("shebang", []string{"one"})
+
+	tests := []struct {
+		name string
+		rule string
+		want int
+	}{
+		{name: "templated", rule: "loop", want: 0},
+		{name: "interpreter", rule: "interp", want: 1},
+		{name: "shebang", rule: "shebang", want: 0},
+		{name: "shebang argument", rule: "shebangarg", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LocalExecutor{name: "test"}
+			got, _ := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const IgnoreErrorFile = `
+wf_file:
+  - rule: dash
+    c:
+      - -false
+      - echo after dash
+  - rule: mapping
+    c:
+      - cmd: "false"
+        ignore_error: true
+      - echo after mapping
+  - rule: optional
+    continue_on_error: true
+    c:
+      - "false"
+      - echo never
+  - rule: cleanup
+    deps: [optional]
+    c:
+      - echo cleaned up
+  - rule: strict
+    c:
+      - "false"
+      - echo never
+`
+
+func TestLocalExecutor_IgnoreErrors(t *testing.T) {
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(IgnoreErrorFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    int
+		wantOut []string
+		wantNot []string
+	}{
+		{name: "dash prefix", rule: "dash", want: 0, wantOut: []string{"exited with 1, ignored", "after dash"}},
+		{name: "ignore_error", rule: "mapping", want: 0, wantOut: []string{"after mapping"}},
+		{
+			name:    "continue_on_error",
+			rule:    "cleanup",
+			want:    0,
+			wantOut: []string{"rule optional failed, continuing", "cleaned up"},
+			wantNot: []string{"never"},
+		},
+		{name: "stops", rule: "strict", want: 1, wantNot: []string{"never"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{name: "test", stdout: &out, stderr: &out}
+			got, _ := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Run() output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, not := range tt.wantNot {
+				if strings.Contains(out.String(), "\n"+not+"\n") {
+					t.Errorf("Run() output contains %q:\n%s", not, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// withHooks runs body between the before and after hooks of rule, or of
+// the top level when rule is "". If anything failed the on_failure hooks
+// run next, and the finally hooks run last in any case. body returns the
+// rule that failed along with how.
+//
+// on_failure and finally hooks run even once ctx is cancelled, so they
+// can clean up after an interrupted run, until a second signal arrives.
+func (l *LocalExecutor) withHooks(ctx context.Context, rcfile rcparse.RCFile, rule string,
+	body func() (int, string, error)) (int, string, error) {
+	rv, err := l.runHook(ctx, rcfile, rule, rcparse.HookBefore, rcparse.HookStatus{})
+	failed := hookFailed(rule, rcparse.HookBefore)
+	if err == nil && rv == 0 {
+		rv, failed, err = body()
+		if err == nil && rv == 0 {
+			failed = ""
+			rv, err = l.runHook(ctx, rcfile, rule, rcparse.HookAfter, rcparse.HookStatus{})
+			if err != nil || rv != 0 {
+				failed = hookFailed(rule, rcparse.HookAfter)
+			}
+		}
+	}
+
+	status := rcparse.HookStatus{Failed: failed, ExitCode: rv}
+	cleanup, stop := cleanupContext(ctx)
+	defer stop()
+	if err != nil || rv != 0 {
+		if hrv, herr := l.runHook(cleanup, rcfile, rule, rcparse.HookOnFailure, status); herr != nil || hrv != 0 {
+			l.warn("%s hook failed: %v", rcparse.HookOnFailure, failure(hrv, herr))
+		}
+	}
+
+	frv, ferr := l.runHook(cleanup, rcfile, rule, rcparse.HookFinally, status)
+	if err == nil && rv == 0 {
+		if ferr != nil || frv != 0 {
+			failed = hookFailed(rule, rcparse.HookFinally)
+		}
+		return frv, failed, ferr
+	}
+	if ferr != nil || frv != 0 {
+		l.warn("%s hook failed: %v", rcparse.HookFinally, failure(frv, ferr))
+	}
+	return rv, failed, err
+}
+
+// hookFailed is what hooks are told failed when hook of rule did: the
+// rule, or the hook itself at the top level.
+func hookFailed(rule string, hook string) string {
+	if rule == "" {
+		return hook
+	}
+	return rule
+}
+
+// runHook runs the commands of hook, stopping at the first that fails.
+func (l *LocalExecutor) runHook(ctx context.Context, rcfile rcparse.RCFile, rule string, hook string,
+	status rcparse.HookStatus) (int, error) {
+	r, env, err := rcfile.HookCommandEnv(rule, hook, status)
+	if err != nil {
+		return -1, err
+	}
+
+	run := *l
+	run.rule = r
+	return run.runList(ctx, r.Cmd, env, nil)
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const HooksFile = `
+shell: sh -c
+before:
+  - echo global before
+after:
+  - echo global after
+on_failure:
+  - echo "global failure {{.Failed}} {{.ExitCode}} $WF_FAILED_RULE $WF_EXIT_CODE"
+finally:
+  - echo global finally
+wf_file:
+  - rule: ok
+    before:
+      - echo rule before
+    after:
+      - echo rule after
+    on_failure:
+      - echo rule failure
+    finally:
+      - echo rule finally
+    c:
+      - echo ok ran
+  - rule: fails
+    on_failure:
+      - echo "rule failure {{.Failed}} $WF_EXIT_CODE"
+    finally:
+      - echo "rule finally {{.ExitCode}}"
+    c:
+      - exit 3
+      - echo never
+  - rule: badbefore
+    before:
+      - exit 2
+    finally:
+      - echo rule finally
+    c:
+      - echo never
+  - rule: badfinally
+    finally:
+      - exit 4
+    c:
+      - echo ran
+`
+
+func TestLocalExecutor_Hooks(t *testing.T) {
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(HooksFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    int
+		wantOut []string
+		wantNot []string
+	}{
+		{
+			name: "success",
+			rule: "ok",
+			want: 0,
+			wantOut: []string{"global before", "rule before", "ok ran", "rule after", "rule finally",
+				"global after", "global finally"},
+			wantNot: []string{"failure"},
+		},
+		{
+			name: "failure",
+			rule: "fails",
+			want: 3,
+			wantOut: []string{"global before", "rule failure fails 3", "rule finally 3",
+				"global failure fails 3 fails 3", "global finally"},
+			wantNot: []string{"never", "global after"},
+		},
+		{
+			name:    "before fails",
+			rule:    "badbefore",
+			want:    2,
+			wantOut: []string{"rule finally", "global failure badbefore 2 badbefore 2"},
+			wantNot: []string{"never"},
+		},
+		{
+			name:    "finally fails",
+			rule:    "badfinally",
+			want:    4,
+			wantOut: []string{"ran", "global failure badfinally 4 badfinally 4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{name: "test", stdout: &out, stderr: &out}
+			got, _ := l.RunWithContext(context.Background(), tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v\n%s", got, tt.want, out.String())
+			}
+
+			last := -1
+			for _, want := range tt.wantOut {
+				i := strings.Index(out.String(), want+"\n")
+				if i < 0 {
+					t.Errorf("Run() output missing %q:\n%s", want, out.String())
+				} else if i < last {
+					t.Errorf("Run() %q out of order:\n%s", want, out.String())
+				}
+				last = i
+			}
+			for _, not := range tt.wantNot {
+				if strings.Contains(out.String(), not+"\n") {
+					t.Errorf("Run() output contains %q:\n%s", not, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestLocalExecutor_TopHookFails(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(`
+shell: sh -c
+before:
+  - exit 5
+on_failure:
+  - echo "failed {{.Failed}} $WF_FAILED_RULE $WF_EXIT_CODE"
+wf_file:
+  - rule: ok
+    c:
+      - echo never
+`))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	var out bytes.Buffer
+	l := &LocalExecutor{name: "test", stdout: &out, stderr: &out}
+	got, _ := l.RunWithContext(context.Background(), "ok", rcfile)
+	if got != 5 {
+		t.Errorf("Run() got = %v, want 5\n%s", got, out.String())
+	}
+	if want := "failed before before 5\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("Run() output missing %q:\n%s", want, out.String())
+	}
+}
+
+const CleanupFile = `
+shell: sh -c
+wf_file:
+  - rule: slow
+    on_failure:
+      - sleep 10
+      - echo cleaned up
+    c:
+      - sleep 10
+`
+
+func TestLocalExecutor_HooksForced(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(CleanupFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	var out bytes.Buffer
+	l := &LocalExecutor{name: "test", stdout: &out, stderr: &out, GracePeriod: 200 * time.Millisecond}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx, force := withForce(ctx)
+	time.AfterFunc(200*time.Millisecond, func() {
+		cancel(Interrupt{syscall.SIGINT})
+	})
+	time.AfterFunc(500*time.Millisecond, func() {
+		force(Interrupt{syscall.SIGINT})
+	})
+
+	start := time.Now()
+	got, _ := l.RunWithContext(ctx, "slow", rcfile)
+	if got != 130 {
+		t.Errorf("RunWithContext() got = %v, want 130\n%s", got, out.String())
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunWithContext() took %v to stop the hook", elapsed)
+	}
+	if strings.Contains(out.String(), "cleaned up") {
+		t.Errorf("RunWithContext() went on with the hook after it was forced:\n%s", out.String())
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watcher reports changes to files in a set of directories, using
+// inotify.
+type watcher struct {
+	f *os.File
+	// dirs maps each inotify watch to its directory.
+	dirs map[int]string
+	// recursive holds the directories whose new subdirectories are
+	// watched as well.
+	recursive map[string]bool
+
+	// Changes gets the path of every file created, written, moved or
+	// removed.
+	Changes chan string
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &watcher{
+		f:         os.NewFile(uintptr(fd), "inotify"),
+		dirs:      map[int]string{},
+		recursive: map[string]bool{},
+		Changes:   make(chan string, 16),
+	}, nil
+}
+
+// Add watches dir, and with recursive every directory below it too.
+// Directories that don't exist are skipped.
+func (w *watcher) Add(dir string, recursive bool) error {
+	if !recursive {
+		return w.addDir(dir, false)
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return w.addDir(path, true)
+	})
+}
+
+func (w *watcher) addDir(dir string, recursive bool) error {
+	wd, err := unix.InotifyAddWatch(int(w.f.Fd()), dir, watchMask|unix.IN_ONLYDIR)
+	if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+		return nil
+	}
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[wd] = dir
+	if recursive {
+		w.recursive[dir] = true
+	}
+	return nil
+}
+
+// Run reads events, passing them on to Changes, until the watcher is
+// closed.
+func (w *watcher) Run() {
+	defer close(w.Changes)
+
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off])) //nolint:gosec
+			name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(ev.Len)]
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+
+			dir, ok := w.dirs[int(ev.Wd)]
+			if !ok || len(name) == 0 {
+				continue
+			}
+			path := filepath.Join(dir, string(bytes.TrimRight(name, "\x00")))
+
+			if ev.Mask&unix.IN_ISDIR != 0 {
+				if ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && w.recursive[dir] {
+					_ = w.Add(path, true)
+				}
+				continue
+			}
+			w.Changes <- path
+		}
+	}
+}
+
+func (w *watcher) Close() error {
+	return w.f.Close()
+}
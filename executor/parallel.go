@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/stillson/go-wf/rcparse"
+	"github.com/stillson/go-wf/termui"
+)
+
+type ruleResult struct {
+	rule string
+	rv   int
+	err  error
+}
+
+// RunRules runs rules and everything they depend on, using up to jobs
+// workers. A rule is started once all of its dependencies have
+// finished successfully. After the first failure no new rules are
+// started, and the exit code of that failure is returned.
+//
+// Cancelling ctx stops the running commands and keeps any more from
+// starting.
+//
+// With more than one worker the output of every rule is line buffered
+// and labeled with the rule name, so concurrent rules stay readable.
+//
+// The top level hooks of rcfile run around all of it.
+func (l *LocalExecutor) RunRules(ctx context.Context, rules []string, rcfile rcparse.RCFile, jobs int) (int, error) {
+	order, err := DepOrder(rcfile, rules...)
+	if err != nil {
+		return -1, err
+	}
+
+	rv, _, err := l.withHooks(ctx, rcfile, "", func() (int, string, error) {
+		if jobs <= 1 {
+			return l.runSerial(ctx, order, rcfile)
+		}
+		return l.runParallel(ctx, order, rcfile, jobs)
+	})
+	return rv, err
+}
+
+// runSerial runs the rules in order, one at a time, and returns the rule
+// that failed, if one did.
+func (l *LocalExecutor) runSerial(ctx context.Context, order []string, rcfile rcparse.RCFile) (int, string, error) {
+	_, green := termui.GetColorPrints()
+	stdout, _ := l.outputs()
+	for _, r := range order {
+		if ctx.Err() != nil {
+			rv, err := ctxError(ctx)
+			return rv, "", err
+		}
+		if len(order) > 1 {
+			_, _ = green.Fprintf(stdout, "rule: %v\n", r)
+		}
+		rv, err := l.runRule(ctx, r, rcfile)
+		if err != nil || rv != 0 {
+			return rv, r, err
+		}
+	}
+	return 0, "", nil
+}
+
+func (l *LocalExecutor) runParallel(ctx context.Context, order []string, rcfile rcparse.RCFile,
+	jobs int) (int, string, error) {
+	waiting := map[string]int{}
+	dependents := map[string][]string{}
+	ready := []string{}
+	labels := map[string]int{}
+
+	for i, rule := range order {
+		labels[rule] = i
+		deps, _ := rcfile.GetDeps(rule)
+		waiting[rule] = len(deps)
+		for _, dep := range deps {
+			dependents[dep] = append(dependents[dep], rule)
+		}
+		if len(deps) == 0 {
+			ready = append(ready, rule)
+		}
+	}
+
+	mu := &sync.Mutex{}
+	results := make(chan ruleResult)
+	running := 0
+	rv := 0
+	failed := ""
+	errs := []error{}
+
+	for len(ready) > 0 || running > 0 {
+		for rv == 0 && ctx.Err() == nil && running < jobs && len(ready) > 0 {
+			rule := ready[0]
+			ready = ready[1:]
+			running++
+
+			go func(rule string) {
+				rrv, err := l.runLabeled(ctx, rule, labels[rule], rcfile, mu)
+				results <- ruleResult{rule, rrv, err}
+			}(rule)
+		}
+		if running == 0 {
+			if ctx.Err() != nil && rv == 0 {
+				rv, err := ctxError(ctx)
+				return rv, "", err
+			}
+			break
+		}
+
+		res := <-results
+		running--
+
+		if res.err != nil || res.rv != 0 {
+			if rv == 0 {
+				rv, failed = res.rv, res.rule
+				if rv == 0 {
+					rv = -1
+				}
+			}
+			if res.err != nil {
+				errs = append(errs, fmt.Errorf("rule %s: %w", res.rule, res.err))
+			} else {
+				errs = append(errs, fmt.Errorf("rule %s exited with %d", res.rule, res.rv))
+			}
+			continue
+		}
+
+		for _, d := range dependents[res.rule] {
+			waiting[d]--
+			if waiting[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	return rv, failed, errors.Join(errs...)
+}
+
+// runLabeled runs a single rule with its output prefixed by the rule name.
+func (l *LocalExecutor) runLabeled(ctx context.Context, rule string, label int, rcfile rcparse.RCFile, mu *sync.Mutex) (int, error) {
+	stdout, stderr := l.outputs()
+	prefix := termui.RuleColor(label).Sprintf("[%s] ", rule)
+	out := termui.NewPrefixWriter(stdout, mu, prefix)
+	errOut := termui.NewPrefixWriter(stderr, mu, prefix)
+
+	sub := *l
+	sub.stdin = nil
+	sub.stdout, sub.stderr = out, errOut
+	rv, err := sub.runRule(ctx, rule, rcfile)
+
+	_ = out.Flush()
+	_ = errOut.Flush()
+	return rv, err
+}
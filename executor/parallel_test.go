@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const PARALLELFILE = `
+wf_file:
+  - rule: build
+    c:
+     - echo built
+  - rule: lint
+    c:
+     - echo linted
+  - rule: test
+    deps: [build]
+    c:
+     - echo tested
+     - echo again
+  - rule: fail
+    c:
+     - "false"
+  - rule: after_fail
+    deps: [fail]
+    c:
+     - echo should not run
+`
+
+func TestLocalExecutor_RunRules(t *testing.T) {
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(PARALLELFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		rules    []string
+		jobs     int
+		want     int
+		wantErr  bool
+		wantOut  []string
+		wantNot  []string
+		ordering []string
+	}{
+		{
+			name:     "serial",
+			rules:    []string{"test"},
+			jobs:     1,
+			want:     0,
+			wantOut:  []string{"built\n", "tested\n", "again\n"},
+			ordering: []string{"built", "tested", "again"},
+		},
+		{
+			name:     "parallel",
+			rules:    []string{"lint", "test"},
+			jobs:     4,
+			want:     0,
+			wantOut:  []string{"[lint] linted\n", "[build] built\n", "[test] tested\n", "[test] again\n"},
+			ordering: []string{"[build] built", "[test] tested", "[test] again"},
+		},
+		{
+			name:    "parallel failure",
+			rules:   []string{"lint", "after_fail"},
+			jobs:    2,
+			want:    1,
+			wantErr: true,
+			wantNot: []string{"should not run"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{
+				name:   "test",
+				stdout: &out,
+				stderr: &out,
+			}
+			got, err := l.RunRules(context.Background(), tt.rules, rcfile, tt.jobs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RunRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RunRules() got = %v, want %v", got, tt.want)
+			}
+
+			output := out.String()
+			for _, want := range tt.wantOut {
+				if !strings.Contains(output, want) {
+					t.Errorf("RunRules() output missing %q:\n%s", want, output)
+				}
+			}
+			for _, not := range tt.wantNot {
+				if strings.Contains(output, not) {
+					t.Errorf("RunRules() output contains %q:\n%s", not, output)
+				}
+			}
+			last := -1
+			for _, o := range tt.ordering {
+				i := strings.Index(output, o)
+				if i < last {
+					t.Errorf("RunRules() %q out of order:\n%s", o, output)
+				}
+				last = i
+			}
+		})
+	}
+}
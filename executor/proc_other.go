@@ -0,0 +1,63 @@
+//go:build !unix
+
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// setProcGroup does nothing where there are no process groups.
+func setProcGroup(_ *exec.Cmd) {}
+
+// setSession does nothing where there are no sessions.
+func setSession(_ *exec.Cmd) {}
+
+// ownsTerminal reports whether f is a terminal wf is in the foreground of.
+func ownsTerminal(_ *os.File) bool {
+	return false
+}
+
+// notifyInterrupt has ch told of Ctrl-C.
+func notifyInterrupt(ch chan<- os.Signal) {
+	signal.Notify(ch, os.Interrupt)
+}
+
+// signalOf reports nothing where commands aren't killed by signals.
+func signalOf(_ *os.ProcessState) (syscall.Signal, bool) {
+	return 0, false
+}
+
+// interruptedBy reports nothing where commands aren't killed by signals.
+func interruptedBy(_ *os.ProcessState) (os.Signal, bool) {
+	return nil, false
+}
+
+// notifyResize does nothing where there is no SIGWINCH.
+func notifyResize(_ chan<- os.Signal) {}
+
+// signalGroup sends sig to a started command.
+func signalGroup(ecmd *exec.Cmd, sig os.Signal) error {
+	if sig == os.Kill {
+		return ecmd.Process.Kill()
+	}
+	return ecmd.Process.Signal(sig)
+}
+
+// groupAlive reports whether the command is still running.
+func groupAlive(ecmd *exec.Cmd) bool {
+	return ecmd.ProcessState == nil
+}
@@ -0,0 +1,95 @@
+//go:build unix
+
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// setProcGroup puts the command in a process group of its own, so a
+// signal reaches everything it starts and not just the command itself.
+func setProcGroup(ecmd *exec.Cmd) {
+	if ecmd.SysProcAttr == nil {
+		ecmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	if !ecmd.SysProcAttr.Setsid {
+		ecmd.SysProcAttr.Setpgid = true
+	}
+}
+
+// setSession starts the command in a session of its own, with the
+// terminal given to it as stdout as its controlling terminal.
+func setSession(ecmd *exec.Cmd) {
+	if ecmd.SysProcAttr == nil {
+		ecmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	ecmd.SysProcAttr.Setpgid = false
+	ecmd.SysProcAttr.Setsid = true
+	ecmd.SysProcAttr.Setctty = true
+	ecmd.SysProcAttr.Ctty = 1
+}
+
+// ownsTerminal reports whether f is a terminal wf is in the foreground of.
+func ownsTerminal(f *os.File) bool {
+	pgrp, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == unix.Getpgrp()
+}
+
+// notifyInterrupt has ch told of the signals a terminal sends for
+// Ctrl-C and Ctrl-\.
+func notifyInterrupt(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGQUIT)
+}
+
+// signalOf returns the signal that killed a command, if one did.
+func signalOf(ps *os.ProcessState) (syscall.Signal, bool) {
+	ws, ok := ps.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return 0, false
+	}
+	return ws.Signal(), true
+}
+
+// interruptedBy returns the signal that killed a command, if it was one
+// a terminal sends for Ctrl-C or Ctrl-\.
+func interruptedBy(ps *os.ProcessState) (os.Signal, bool) {
+	if sig, ok := signalOf(ps); ok && (sig == syscall.SIGINT || sig == syscall.SIGQUIT) {
+		return sig, true
+	}
+	return nil, false
+}
+
+// notifyResize has ch told when the size of the terminal changes.
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+// signalGroup sends sig to the process group of a started command.
+func signalGroup(ecmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		s = syscall.SIGTERM
+	}
+	return syscall.Kill(-ecmd.Process.Pid, s)
+}
+
+// groupAlive reports whether anything is left in the command's process group.
+func groupAlive(ecmd *exec.Cmd) bool {
+	return syscall.Kill(-ecmd.Process.Pid, 0) == nil
+}
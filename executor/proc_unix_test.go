@@ -0,0 +1,200 @@
+//go:build unix
+
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+	"github.com/stillson/go-wf/termui"
+)
+
+const INTERRUPTFILE = `
+wf_file:
+  - rule: sleepy
+    c:
+     - sh -c 'echo READY; sleep 30'
+     - echo SECOND-RAN
+  - rule: trapped
+    c:
+     - cmd: sh -c 'trap "exit 1" INT; echo READY; sleep 30'
+       ignore_error: true
+     - echo SECOND-RAN
+  - rule: retried
+    retries: 3
+    c:
+     - sh -c 'echo READY; sleep 30'
+`
+
+// TestHelperInterrupt is run by TestLocalExecutor_TerminalInterrupt as wf,
+// on a terminal of its own.
+func TestHelperInterrupt(t *testing.T) {
+	rule := os.Getenv("WF_TEST_INTERRUPT")
+	if rule == "" {
+		t.Skip("only run by TestLocalExecutor_TerminalInterrupt")
+	}
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(INTERRUPTFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	ctx, stop := WithSignals(context.Background())
+	l := NewLocalExec("test")
+	l.GracePeriod = 200 * time.Millisecond
+	rv, _ := l.RunWithContext(ctx, rule, rcfile)
+	stop()
+	os.Exit(rv)
+}
+
+func TestLocalExecutor_TerminalInterrupt(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("no pseudo terminals here")
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		want int
+	}{
+		{name: "killed", rule: "sleepy", want: 130},
+		{name: "trapped", rule: "trapped", want: 130},
+		{name: "not retried", rule: "retried", want: 130},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, slave, err := termui.OpenPty()
+			if err != nil {
+				t.Skipf("no pseudo terminal: %v", err)
+			}
+			defer func() {
+				_ = master.Close()
+			}()
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestHelperInterrupt$") //nolint:gosec
+			cmd.Env = append(os.Environ(), "WF_TEST_INTERRUPT="+tt.rule)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			_ = slave.Close()
+
+			var mu sync.Mutex
+			var out bytes.Buffer
+			go func() {
+				buf := make([]byte, 1024)
+				for {
+					n, err := master.Read(buf)
+					mu.Lock()
+					out.Write(buf[:n])
+					mu.Unlock()
+					if err != nil {
+						return
+					}
+				}
+			}()
+			output := func() string {
+				mu.Lock()
+				defer mu.Unlock()
+				return out.String()
+			}
+
+			deadline := time.Now().Add(10 * time.Second)
+			for !strings.Contains(output(), "READY\r\n") && time.Now().Before(deadline) {
+				time.Sleep(20 * time.Millisecond)
+			}
+			time.Sleep(100 * time.Millisecond)
+			if _, err := master.Write([]byte{3}); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- cmd.Wait()
+			}()
+			select {
+			case err = <-done:
+			case <-time.After(10 * time.Second):
+				_ = cmd.Process.Kill()
+				t.Fatalf("wf didn't stop after Ctrl-C:\n%s", output())
+			}
+
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != tt.want {
+				t.Errorf("wf exited with %v, want %d:\n%s", err, tt.want, output())
+			}
+			if strings.Contains(output(), "SECOND-RAN\r\n") {
+				t.Errorf("wf went on after Ctrl-C:\n%s", output())
+			}
+			if n := strings.Count(output(), "READY\r\n"); n != 1 {
+				t.Errorf("wf ran the command %d times:\n%s", n, output())
+			}
+		})
+	}
+}
+
+func TestLocalExecutor_Killed(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(`
+wf_file:
+  - rule: killed
+    c:
+     - sh -c 'kill -KILL $$'
+  - rule: missing
+    c:
+     - /nonexistent/wf-test
+`))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    int
+		wantErr error
+	}{
+		{name: "killed", rule: "killed", want: 137, wantErr: &ExitError{Code: 137, Signal: syscall.SIGKILL}},
+		{name: "missing program", rule: "missing", want: -1, wantErr: ErrCommandNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{name: "test", stdout: &out, stderr: &out}
+			got, err := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+			var exitErr *ExitError
+			switch want := tt.wantErr.(type) {
+			case *ExitError:
+				if !errors.As(err, &exitErr) || *exitErr != *want {
+					t.Errorf("Run() error = %v, want %v", err, want)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("Run() error = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// Local is the name of the executor that runs commands on this machine.
+// It is what rules without an executor use.
+const Local = "local"
+
+// ErrExecutorNotFound is returned for a rule naming an executor that
+// hasn't been registered.
+var ErrExecutorNotFound = errors.New("executor not found")
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Executor{}
+)
+
+// Register makes e available to rules as executor: name. It panics if
+// name is already taken, or e is nil.
+func Register(name string, e Executor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if e == nil {
+		panic("executor: Register executor is nil")
+	}
+	if name == "" || name == Local {
+		panic(fmt.Sprintf("executor: Register of reserved name %q", name))
+	}
+	if _, dup := registry[name]; dup {
+		panic("executor: Register called twice for " + name)
+	}
+	registry[name] = e
+}
+
+// unregister forgets the executor registered as name, for tests.
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(registry, name)
+}
+
+// Lookup returns the executor registered as name.
+func Lookup(name string) (Executor, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	e, ok := registry[name]
+	return e, ok
+}
+
+// Executors returns the names of the registered executors, along with
+// the local one.
+func Executors() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := []string{Local}
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// runElsewhere hands rule to the executor registered as name. Its
+// dependencies have already been run, so they are hidden from it.
+func runElsewhere(ctx context.Context, name string, rule string, rcfile rcparse.RCFile) (int, error) {
+	e, ok := Lookup(name)
+	if !ok {
+		return -1, fmt.Errorf("rule %s: %w: %s", rule, ErrExecutorNotFound, name)
+	}
+
+	rv, err := e.RunWithContext(ctx, rule, noDeps{rcfile})
+	if err == nil && ctx.Err() != nil {
+		return ctxError(ctx)
+	}
+	return rv, err
+}
+
+// noDeps is an rcfile whose rules depend on nothing.
+type noDeps struct {
+	rcparse.RCFile
+}
+
+func (n noDeps) GetDeps(rule string) ([]string, bool) {
+	_, exists := n.RCFile.GetDeps(rule)
+	return []string{}, exists
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// fakeExecutor records the rules it is given.
+type fakeExecutor struct {
+	ran  []string
+	deps [][]string
+	rv   int
+}
+
+func (f *fakeExecutor) Run(rule string, rcfile rcparse.RCFile) (int, error) {
+	return f.RunWithContext(context.Background(), rule, rcfile)
+}
+
+func (f *fakeExecutor) RunWithContext(_ context.Context, rule string, rcfile rcparse.RCFile) (int, error) {
+	deps, _ := rcfile.GetDeps(rule)
+	f.ran = append(f.ran, rule)
+	f.deps = append(f.deps, deps)
+	if f.rv != 0 {
+		return f.rv, &ExitError{Code: f.rv}
+	}
+	return 0, nil
+}
+
+const RegistryFile = `
+wf_file:
+  - rule: build
+    c:
+      - "true"
+  - rule: remote
+    executor: fake
+    deps: [build]
+    c:
+      - never run locally
+  - rule: local
+    executor: local
+    c:
+      - "true"
+  - rule: unknown
+    executor: nowhere
+    c:
+      - "true"
+`
+
+func TestRegistry(t *testing.T) {
+	fake := &fakeExecutor{}
+	Register("fake", fake)
+	t.Cleanup(func() {
+		unregister("fake")
+	})
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(RegistryFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		rv      int
+		want    int
+		wantErr error
+		wantRan []string
+	}{
+		{name: "delegated", rule: "remote", want: 0, wantRan: []string{"remote"}},
+		{name: "delegated failure", rule: "remote", rv: 2, want: 2, wantRan: []string{"remote"}},
+		{name: "local", rule: "local", want: 0},
+		{name: "unknown", rule: "unknown", want: -1, wantErr: ErrExecutorNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.ran, fake.deps, fake.rv = nil, nil, tt.rv
+			l := NewLocalExec("test")
+			got, err := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(fake.ran, tt.wantRan) {
+				t.Errorf("Run() delegated %v, want %v", fake.ran, tt.wantRan)
+			}
+			for _, deps := range fake.deps {
+				if len(deps) != 0 {
+					t.Errorf("Run() delegated with deps %v", deps)
+				}
+			}
+		})
+	}
+
+	if !slices.Equal(Executors(), []string{Local, "fake"}) {
+		t.Errorf("Executors() = %v", Executors())
+	}
+	for _, name := range []string{"fake", Local, ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register(%q) did not panic", name)
+				}
+			}()
+			Register(name, fake)
+		}()
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// runRetrying runs command c, trying again as often as its retry options
+// allow, each taken from its rule's unless the command sets it. The wait
+// between attempts doubles each time.
+func (l *LocalExecutor) runRetrying(ctx context.Context, c string, opts rcparse.CmdOpts,
+	env map[string]string, extra []string) (int, error) {
+	retry := opts.RetryOpts.Over(l.rule.Retry)
+	attempts := retry.Retries + 1
+	delay := retry.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+		rv, err := l.runOnce(ctx, c, opts, env, extra)
+		if (rv == 0 && err == nil) || attempt == attempts || !retryable(ctx, rv, err, retry) {
+			return rv, err
+		}
+
+		wait := ""
+		if delay > 0 {
+			wait = " in " + shortDuration(delay)
+		}
+		l.warn("%v, attempt %d/%d%s", failure(rv, err), attempt+1, attempts, wait)
+
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctxError(ctx)
+			case <-t.C:
+			}
+			delay *= 2
+		}
+	}
+}
+
+// runOnce runs command c a single time.
+func (l *LocalExecutor) runOnce(ctx context.Context, c string, opts rcparse.CmdOpts,
+	env map[string]string, extra []string) (int, error) {
+	ctx, cancel := withTimeout(ctx, opts.Timeout, fmt.Sprintf("command %q", c))
+	defer cancel()
+
+	if opts.Script {
+		return l.runScript(ctx, c, env, extra)
+	}
+	return l.subRun(ctx, c, env, extra)
+}
+
+// retryable reports whether a command that failed with rv and err is
+// worth trying again: it exited with a code retry allows, or ran out of
+// its own time, and its rule is still going.
+func retryable(ctx context.Context, rv int, err error, retry rcparse.RetryOpts) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var exitErr *ExitError
+	var timeout Timeout
+	if err != nil && !errors.As(err, &exitErr) && !errors.As(err, &timeout) {
+		return false
+	}
+	return len(retry.RetryOnExitCodes) == 0 || slices.Contains(retry.RetryOnExitCodes, rv)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// RetryFile has rules whose command fails until its third attempt,
+// counting attempts in a file named after the rule.
+const RetryFile = `
+shell: sh -c
+wf_file:
+  - rule: third
+    retries: 2
+    c:
+      - &flaky n=$(cat {{.V.dir}}/{{.V.rule}} 2>/dev/null || echo 0); n=$((n+1)); echo $n > {{.V.dir}}/{{.V.rule}}; [ $n -ge 3 ]
+  - rule: toofew
+    retries: 1
+    c:
+      - *flaky
+  - rule: codes
+    retries: 2
+    retry_on_exit_codes: [75]
+    c:
+      - *flaky
+  - rule: percmd
+    retries: 5
+    c:
+      - cmd: *flaky
+        retries: 1
+  - rule: backoff
+    retries: 2
+    retry_delay: 20ms
+    c:
+      - *flaky
+  - rule: optout
+    retries: 5
+    c:
+      - cmd: *flaky
+        retries: 0
+  - rule: cmdcodes
+    retries: 2
+    c:
+      - cmd: *flaky
+        retry_on_exit_codes: [75]
+  - rule: cmddelay
+    retries: 2
+    c:
+      - cmd: *flaky
+        retry_delay: 20ms
+`
+
+func TestLocalExecutor_Retry(t *testing.T) {
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    int
+		wantOut []string
+		wantNot []string
+		minTime time.Duration
+	}{
+		{
+			name:    "succeeds on the third attempt",
+			rule:    "third",
+			want:    0,
+			wantOut: []string{"exited with 1, attempt 2/3\n", "exited with 1, attempt 3/3\n"},
+		},
+		{
+			name:    "runs out of attempts",
+			rule:    "toofew",
+			want:    1,
+			wantOut: []string{"attempt 2/2"},
+			wantNot: []string{"attempt 3/"},
+		},
+		{
+			name:    "other exit code",
+			rule:    "codes",
+			want:    1,
+			wantNot: []string{"attempt"},
+		},
+		{
+			name:    "command overrides rule",
+			rule:    "percmd",
+			want:    1,
+			wantOut: []string{"attempt 2/2"},
+		},
+		{
+			name:    "backoff",
+			rule:    "backoff",
+			want:    0,
+			wantOut: []string{"attempt 2/3 in 20ms", "attempt 3/3 in 40ms"},
+			minTime: 60 * time.Millisecond,
+		},
+		{
+			name:    "command opts out",
+			rule:    "optout",
+			want:    1,
+			wantNot: []string{"attempt"},
+		},
+		{
+			name:    "command exit codes",
+			rule:    "cmdcodes",
+			want:    1,
+			wantNot: []string{"attempt"},
+		},
+		{
+			name:    "command delay",
+			rule:    "cmddelay",
+			want:    0,
+			wantOut: []string{"attempt 2/3 in 20ms", "attempt 3/3 in 40ms"},
+			minTime: 60 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcfile, err := rcparse.CreateYRCFile(strings.NewReader(RetryFile))
+			if err != nil {
+				t.Fatalf("Unable to parse test rcfile: %v", err)
+			}
+			rcfile.V["dir"] = t.TempDir()
+			rcfile.V["rule"] = tt.rule
+
+			var out bytes.Buffer
+			l := &LocalExecutor{name: "test", stdout: &out, stderr: &out}
+			start := time.Now()
+			got, _ := l.Run(tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("Run() got = %v, want %v\n%s", got, tt.want, out.String())
+			}
+			if elapsed := time.Since(start); elapsed < tt.minTime {
+				t.Errorf("Run() took %v, want at least %v", elapsed, tt.minTime)
+			}
+			for _, want := range tt.wantOut {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Run() output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, not := range tt.wantNot {
+				if strings.Contains(out.String(), not) {
+					t.Errorf("Run() output contains %q:\n%s", not, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// Interrupt is the cause of a context cancelled by WithSignals.
+type Interrupt struct {
+	Signal os.Signal
+}
+
+func (i Interrupt) Error() string {
+	return fmt.Sprintf("interrupted by %v", i.Signal)
+}
+
+// ExitCode is the shell convention for a process killed by a signal.
+func (i Interrupt) ExitCode() int {
+	if s, ok := i.Signal.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 130
+}
+
+// WithSignals returns a context that is cancelled when SIGINT or SIGTERM
+// arrives. The signal is kept as the context's cause, so it can be
+// passed on to running commands. A second signal also stops the hooks
+// that clean up after the first. Calling stop releases the signals.
+//
+// A command that takes a signal meant for wf, as from a terminal, can
+// also interrupt the context, see interrupt.
+func WithSignals(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	ctx, force := withForce(ctx)
+	ctx = context.WithValue(ctx, interruptKey{}, func(sig os.Signal) {
+		cancel(Interrupt{sig})
+	})
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+
+	go func() {
+		// Only a signal counts as the first one, even if ctx was
+		// cancelled already, so it can't be taken for a second.
+		select {
+		case sig := <-sigs:
+			cancel(Interrupt{sig})
+		case <-stopped:
+			return
+		}
+		select {
+		case sig := <-sigs:
+			force(Interrupt{sig})
+		case <-stopped:
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			signal.Stop(sigs)
+			close(stopped)
+			cancel(context.Canceled)
+			force(context.Canceled)
+		})
+	}
+	return ctx, stop
+}
+
+type interruptKey struct{}
+
+// interrupt cancels the run ctx belongs to with Interrupt{sig}, if it
+// came from WithSignals.
+func interrupt(ctx context.Context, sig os.Signal) {
+	if f, ok := ctx.Value(interruptKey{}).(func(os.Signal)); ok {
+		f(sig)
+	}
+}
+
+type forceKey struct{}
+
+// withForce returns ctx along with a cancel func for the context that
+// cleanupContext ties cleanup work to.
+func withForce(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	forced, force := context.WithCancelCause(context.Background())
+	return context.WithValue(ctx, forceKey{}, forced), force
+}
+
+// cleanupContext returns a context for work that has to run even once ctx
+// is cancelled. It is only cancelled when ctx is forced, as by a second
+// signal, or when stop is called.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	cleanup, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	forced, ok := ctx.Value(forceKey{}).(context.Context)
+	if !ok {
+		return cleanup, func() { cancel(context.Canceled) }
+	}
+	unhook := context.AfterFunc(forced, func() {
+		cancel(context.Cause(forced))
+	})
+	return cleanup, func() {
+		unhook()
+		cancel(context.Canceled)
+	}
+}
+
+// cancelSignal is the signal sent to commands when ctx is cancelled.
+func cancelSignal(ctx context.Context) os.Signal {
+	if i, ok := context.Cause(ctx).(Interrupt); ok {
+		return i.Signal
+	}
+	return syscall.SIGTERM
+}
+
+// ctxError turns the cancellation of ctx into an exit code and error.
+func ctxError(ctx context.Context) (int, error) {
+	switch cause := context.Cause(ctx).(type) {
+	case Interrupt:
+		return cause.ExitCode(), cause
+	case Timeout:
+		return cause.ExitCode(), cause
+	default:
+		return -1, cause
+	}
+}
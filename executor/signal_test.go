@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const SIGNALFILE = `
+wf_file:
+  - rule: sleepy
+    c:
+     - sleep 10
+     - echo should not run
+  - rule: stubborn
+    c:
+     - sh -c 'trap "" TERM INT; sleep 10'
+`
+
+func TestLocalExecutor_RunWithContext(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(SIGNALFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		cause error
+		want  int
+	}{
+		{
+			name:  "interrupt",
+			rule:  "sleepy",
+			cause: Interrupt{syscall.SIGINT},
+			want:  130,
+		},
+		{
+			name:  "terminate",
+			rule:  "sleepy",
+			cause: Interrupt{syscall.SIGTERM},
+			want:  143,
+		},
+		{
+			name:  "killed after grace period",
+			rule:  "stubborn",
+			cause: Interrupt{syscall.SIGINT},
+			want:  130,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{
+				name:        "test",
+				stdout:      &out,
+				stderr:      &out,
+				GracePeriod: 200 * time.Millisecond,
+			}
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			time.AfterFunc(200*time.Millisecond, func() {
+				cancel(tt.cause)
+			})
+
+			start := time.Now()
+			got, err := l.RunWithContext(ctx, tt.rule, rcfile)
+			if !errors.Is(err, tt.cause) {
+				t.Errorf("RunWithContext() error = %v, want %v", err, tt.cause)
+			}
+			if got != tt.want {
+				t.Errorf("RunWithContext() got = %v, want %v", got, tt.want)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("RunWithContext() took %v to stop", elapsed)
+			}
+			if strings.Contains(out.String(), "should not run") {
+				t.Errorf("RunWithContext() ran a command after being cancelled")
+			}
+		})
+	}
+}
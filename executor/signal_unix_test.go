@@ -0,0 +1,53 @@
+//go:build unix
+
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithSignals(t *testing.T) {
+	ctx, stop := WithSignals(context.Background())
+	defer stop()
+	cleanup, done := cleanupContext(ctx)
+	defer done()
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("WithSignals() not cancelled by the first signal")
+	}
+	if !errors.Is(context.Cause(ctx), Interrupt{syscall.SIGINT}) {
+		t.Errorf("WithSignals() cause = %v", context.Cause(ctx))
+	}
+	time.Sleep(100 * time.Millisecond)
+	if cleanup.Err() != nil {
+		t.Fatalf("cleanupContext() cancelled by the first signal")
+	}
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	select {
+	case <-cleanup.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("cleanupContext() not cancelled by the second signal")
+	}
+	if !errors.Is(context.Cause(cleanup), Interrupt{syscall.SIGTERM}) {
+		t.Errorf("cleanupContext() cause = %v", context.Cause(cleanup))
+	}
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const TIMEOUTFILE = `
+wf_file:
+  - rule: rule_timeout
+    timeout: 200ms
+    c:
+     - sleep 10
+     - echo should not run
+  - rule: cmd_timeout
+    c:
+     - cmd: sleep 10
+       timeout: 200ms
+     - echo should not run
+  - rule: in_time
+    timeout: 10s
+    c:
+     - cmd: echo quick
+       timeout: 5s
+`
+
+func TestLocalExecutor_Timeout(t *testing.T) {
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(TIMEOUTFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    int
+		wantErr string
+	}{
+		{
+			name:    "rule",
+			rule:    "rule_timeout",
+			want:    TimeoutExitCode,
+			wantErr: "rule rule_timeout timed out after 200ms",
+		},
+		{
+			name:    "command",
+			rule:    "cmd_timeout",
+			want:    TimeoutExitCode,
+			wantErr: `command "sleep 10" timed out after 200ms`,
+		},
+		{
+			name: "in time",
+			rule: "in_time",
+			want: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{
+				name:        "test",
+				stdout:      &out,
+				stderr:      &out,
+				GracePeriod: 200 * time.Millisecond,
+			}
+
+			got, err := l.RunWithContext(context.Background(), tt.rule, rcfile)
+			if got != tt.want {
+				t.Errorf("RunWithContext() got = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("RunWithContext() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var timeout Timeout
+			if !errors.As(err, &timeout) || err.Error() != tt.wantErr {
+				t.Errorf("RunWithContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Contains(out.String(), "should not run") {
+				t.Errorf("RunWithContext() ran a command after timing out")
+			}
+		})
+	}
+}
+
+func Test_shortDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Minute, "5m"},
+		{90 * time.Second, "1m30s"},
+		{2 * time.Hour, "2h"},
+		{2*time.Hour + 30*time.Second, "2h0m30s"},
+		{200 * time.Millisecond, "200ms"},
+		{10 * time.Second, "10s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := shortDuration(tt.d); got != tt.want {
+				t.Errorf("shortDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/stillson/go-wf/termui"
+)
+
+// runTTY runs ecmd on a pseudo terminal of its own. Input is copied in
+// from wf's stdin, which is put in raw mode if it is a terminal, output
+// is copied out, and window size changes are passed along.
+func (l *LocalExecutor) runTTY(ctx context.Context, ecmd *exec.Cmd) error {
+	master, slave, err := termui.OpenPty()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = master.Close()
+	}()
+
+	if ecmd.Stdin == l.stdin {
+		ecmd.Stdin = slave
+	}
+	ecmd.Stdout, ecmd.Stderr = slave, slave
+	setSession(ecmd)
+
+	stdout, _ := l.outputs()
+	in, _ := l.stdin.(*os.File)
+	if in != nil && termui.IsTerminal(in) {
+		_ = termui.CopyWinsize(in, master)
+		if restore, err := termui.MakeRaw(in); err == nil {
+			defer restore()
+		}
+
+		resize := make(chan os.Signal, 1)
+		notifyResize(resize)
+		defer signal.Stop(resize)
+		go func() {
+			for range resize {
+				_ = termui.CopyWinsize(in, master)
+			}
+		}()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	switch {
+	case in != nil && !atEOF(in):
+		go copyInput(master, in, stop)
+	case in == nil && l.stdin != nil:
+		go feedInput(master, inputOf(l.stdin), stop)
+	}
+
+	copied := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(stdout, master)
+		close(copied)
+	}()
+
+	err = l.runCommand(ctx, ecmd)
+	_ = slave.Close()
+
+	// The output is done once nothing has the terminal open any more,
+	// but don't wait forever on something left running in the background.
+	select {
+	case <-copied:
+	case <-time.After(time.Second):
+	}
+	return err
+}
+
+// atEOF reports whether f is a regular file with nothing left to read,
+// or the null device.
+func atEOF(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if fi.Mode().IsRegular() {
+		pos, err := f.Seek(0, io.SeekCurrent)
+		return err == nil && pos >= fi.Size()
+	}
+	null, err := os.Stat(os.DevNull)
+	return err == nil && os.SameFile(fi, null)
+}
+
+// input reads a reader that isn't a file, which can't be interrupted, for
+// as many commands as need it. Only one read is ever left waiting, and
+// what it returns goes to the next command rather than being lost.
+type input struct {
+	chunks chan []byte
+}
+
+var (
+	inputsMu sync.Mutex
+	inputs   = map[io.Reader]*input{}
+)
+
+// inputOf returns the input reading r, starting it the first time.
+func inputOf(r io.Reader) *input {
+	inputsMu.Lock()
+	defer inputsMu.Unlock()
+
+	if in, ok := inputs[r]; ok {
+		return in
+	}
+	in := &input{chunks: make(chan []byte)}
+	inputs[r] = in
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				in.chunks <- slices.Clone(buf[:n])
+			}
+			if err != nil {
+				inputsMu.Lock()
+				delete(inputs, r)
+				inputsMu.Unlock()
+				close(in.chunks)
+				return
+			}
+		}
+	}()
+	return in
+}
+
+// feedInput copies what in reads to dst until stop is closed. The end of
+// the input is passed along as ^D.
+func feedInput(dst io.Writer, in *input, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case chunk, ok := <-in.chunks:
+			if !ok {
+				_, _ = dst.Write([]byte{4})
+				return
+			}
+			if _, err := dst.Write(chunk); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// copyInput copies src to dst until stop is closed, without leaving a
+// read of src behind to swallow input meant for whatever comes next.
+// The end of src is passed along as ^D.
+func copyInput(dst io.Writer, src *os.File, stop <-chan struct{}) {
+	buf := make([]byte, 4096)
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		ready, err := termui.WaitReadable(src, 100)
+		if err != nil {
+			return
+		}
+		if !ready {
+			continue
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			_, _ = dst.Write([]byte{4})
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+const TTYFILE = `
+wf_file:
+  - rule: tty
+    tty: true
+    c:
+     - sh -c 'test -t 0 && test -t 1 && echo on a tty'
+  - rule: notty
+    c:
+     - sh -c 'test -t 1 || echo not on a tty'
+  - rule: ttyin
+    tty: true
+    c:
+     - head -n 1
+  - rule: stdin
+    stdin: input.txt
+    c:
+     - cat
+     - cat
+  - rule: ttytrue
+    tty: true
+    c:
+     - "true"
+  - rule: missing
+    stdin: nothere.txt
+    c:
+     - cat
+`
+
+func TestLocalExecutor_Stdin(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("no pseudo terminals here")
+	}
+
+	dir := t.TempDir()
+	oldPwd, _ := os.Getwd()
+	defer func() {
+		_ = os.Chdir(oldPwd)
+	}()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Unable to change directory to %s: %v\n", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "input.txt"), []byte("from the file\n"), 0600); err != nil {
+		t.Fatalf("Unable to create input file")
+	}
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(TTYFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		stdin   string
+		want    int
+		wantErr bool
+		wantOut string
+		count   int
+	}{
+		{
+			name:    "tty",
+			rule:    "tty",
+			wantOut: "on a tty",
+			count:   1,
+		},
+		{
+			name:    "no tty",
+			rule:    "notty",
+			wantOut: "not on a tty",
+			count:   1,
+		},
+		{
+			name:    "tty input",
+			rule:    "ttyin",
+			stdin:   "typed in\n",
+			wantOut: "typed in",
+			count:   2,
+		},
+		{
+			name:    "stdin file for every command",
+			rule:    "stdin",
+			wantOut: "from the file",
+			count:   2,
+		},
+		{
+			name:    "missing stdin file",
+			rule:    "missing",
+			want:    -1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			l := &LocalExecutor{
+				name:   "test",
+				stdin:  strings.NewReader(tt.stdin),
+				stdout: &out,
+				stderr: &out,
+			}
+
+			got, err := l.RunWithContext(context.Background(), tt.rule, rcfile)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RunWithContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RunWithContext() got = %v, want %v", got, tt.want)
+			}
+			n := 0
+			for _, line := range strings.Split(out.String(), "\n") {
+				if strings.TrimRight(line, "\r") == tt.wantOut {
+					n++
+				}
+			}
+			if tt.wantOut != "" && n != tt.count {
+				t.Errorf("RunWithContext() output has %q %d times, want %d:\n%s", tt.wantOut, n, tt.count, out.String())
+			}
+		})
+	}
+}
+
+func TestLocalExecutor_TTYInput(t *testing.T) {
+	if _, err := os.Stat("/dev/ptmx"); err != nil {
+		t.Skip("no pseudo terminals here")
+	}
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(TTYFILE))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	// input that never ends, as from a pipe nothing is written to
+	pr, pw := io.Pipe()
+	defer func() {
+		_ = pw.Close()
+	}()
+
+	var out bytes.Buffer
+	l := &LocalExecutor{name: "test", stdin: pr, stdout: &out, stderr: &out}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		if got, err := l.RunWithContext(context.Background(), "ttytrue", rcfile); got != 0 || err != nil {
+			t.Fatalf("RunWithContext() got = %v, %v", got, err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if after := runtime.NumGoroutine(); after > before+1 {
+		t.Errorf("%d goroutines left after 5 commands, want at most 1", after-before)
+	}
+
+	// what is typed later still goes to the next command reading it
+	go func() {
+		_, _ = pw.Write([]byte("typed later\n"))
+	}()
+	out.Reset()
+	if got, err := l.RunWithContext(context.Background(), "ttyin", rcfile); got != 0 || err != nil {
+		t.Fatalf("RunWithContext() got = %v, %v", got, err)
+	}
+	if !strings.Contains(out.String(), "typed later") {
+		t.Errorf("RunWithContext() output %q is missing the input", out.String())
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// StateDir is where wf keeps what it knows about earlier runs, next to
+// the workflow file.
+const StateDir = ".wf"
+
+// freshness is whether a rule can be skipped, and why.
+type freshness struct {
+	skip   bool
+	reason string
+	// sum is the checksum to save once the rule has run.
+	sum string
+}
+
+// checkUpToDate works out whether rule, about to run cmd with args, is up
+// to date, going by r.Method.
+func checkUpToDate(rule string, r rcparse.CmdEnv, cmd []string, args []string) (freshness, error) {
+	dir := r.Dir
+	if dir == "" {
+		dir = "."
+	}
+
+	gens := []string{}
+	for _, pattern := range r.Generates {
+		matches, err := globFiles(dir, pattern)
+		if err != nil {
+			return freshness{}, fmt.Errorf("rule %s: generates: %w", rule, err)
+		}
+		if len(matches) == 0 {
+			return freshness{reason: fmt.Sprintf("nothing matches %s", pattern)}, nil
+		}
+		gens = append(gens, matches...)
+	}
+
+	sources := []string{}
+	for _, pattern := range r.Sources {
+		matches, err := globFiles(dir, pattern)
+		if err != nil {
+			return freshness{}, fmt.Errorf("rule %s: sources: %w", rule, err)
+		}
+		sources = append(sources, matches...)
+	}
+	sort.Strings(sources)
+
+	if r.Method == rcparse.MethodChecksum {
+		if len(sources) == 0 {
+			return freshness{reason: "none of its sources exist"}, nil
+		}
+		return checkSum(rule, dir, sources, cmd, args)
+	}
+	return checkMtime(sources, gens)
+}
+
+func checkMtime(sources []string, gens []string) (freshness, error) {
+	if len(gens) == 0 {
+		return freshness{reason: "it generates nothing to compare with"}, nil
+	}
+
+	oldest, oldestTime, err := mtimes(gens, func(a, b time.Time) bool { return a.Before(b) })
+	if err != nil {
+		return freshness{}, err
+	}
+	if len(sources) == 0 {
+		return freshness{skip: true, reason: "everything it generates exists"}, nil
+	}
+	newest, newestTime, err := mtimes(sources, func(a, b time.Time) bool { return a.After(b) })
+	if err != nil {
+		return freshness{}, err
+	}
+
+	if newestTime.After(oldestTime) {
+		return freshness{reason: fmt.Sprintf("%s is newer than %s", newest, oldest)}, nil
+	}
+	return freshness{skip: true, reason: fmt.Sprintf("%s is not newer than %s", newest, oldest)}, nil
+}
+
+// mtimes returns the file with the modification time first by before.
+func mtimes(files []string, before func(a, b time.Time) bool) (string, time.Time, error) {
+	var first string
+	var firstTime time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		if first == "" || before(info.ModTime(), firstTime) {
+			first, firstTime = f, info.ModTime()
+		}
+	}
+	return first, firstTime, nil
+}
+
+func checkSum(rule string, dir string, sources []string, cmd []string, args []string) (freshness, error) {
+	h := sha256.New()
+	for _, c := range cmd {
+		_, _ = fmt.Fprintf(h, "cmd %q\n", c)
+	}
+	for _, a := range args {
+		_, _ = fmt.Fprintf(h, "arg %q\n", a)
+	}
+	for _, src := range sources {
+		_, _ = fmt.Fprintf(h, "file %q\n", src)
+		if err := hashFile(h, src); err != nil {
+			return freshness{}, err
+		}
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	old, err := os.ReadFile(checksumFile(dir, rule))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return freshness{reason: "it has no checksum from an earlier run", sum: sum}, nil
+	case err != nil:
+		return freshness{}, err
+	case strings.TrimSpace(string(old)) != sum:
+		return freshness{reason: "its sources or commands changed", sum: sum}, nil
+	}
+	return freshness{skip: true, reason: "its sources and commands are unchanged", sum: sum}, nil
+}
+
+func hashFile(w io.Writer, name string) error {
+	f, err := os.Open(name) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func checksumFile(dir string, rule string) string {
+	return filepath.Join(dir, StateDir, "checksums", url.PathEscape(rule))
+}
+
+// saveChecksum records sum as the checksum of the last successful run of
+// rule.
+func saveChecksum(dir string, rule string, sum string) error {
+	if dir == "" {
+		dir = "."
+	}
+	name := checksumFile(dir, rule)
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, []byte(sum+"\n"), 0o644) //nolint:gosec
+}
+
+// globFiles returns the files matching pattern, which is relative to dir.
+// Besides what filepath.Match allows, a ** path element matches any
+// number of directories.
+func globFiles(dir string, pattern string) ([]string, error) {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, pattern)
+	}
+
+	var matches []string
+	if !strings.Contains(pattern, "**") {
+		var err error
+		matches, err = filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		parts := strings.Split(pattern, string(filepath.Separator))
+		i := 0
+		for i < len(parts) && !strings.ContainsAny(parts[i], "*?[\\") {
+			i++
+		}
+		root := strings.Join(parts[:i], string(filepath.Separator))
+		switch {
+		case root != "":
+		case filepath.IsAbs(pattern):
+			root = string(filepath.Separator)
+		default:
+			root = "."
+		}
+		rest := parts[i:]
+
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || rel == "." {
+				return err
+			}
+			if matchElems(rest, strings.Split(rel, string(filepath.Separator))) {
+				matches = append(matches, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := matches[:0]
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() {
+			files = append(files, m)
+		}
+	}
+	return files, nil
+}
+
+// matchElems matches the path elements of name against those of a
+// pattern.
+func matchElems(pattern []string, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElems(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := filepath.Match(pattern[0], name[0])
+	return ok && matchElems(pattern[1:], name[1:])
+}
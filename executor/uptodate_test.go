@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/stillson/go-wf/rcparse"
+)
+
+// writeFiles creates files under dir, each modified age ago.
+func writeFiles(t *testing.T, dir string, files map[string]time.Duration) {
+	t.Helper()
+	for name, age := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		when := time.Now().Add(-age)
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_globFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]time.Duration{
+		"a.go": 0, "b.txt": 0, "sub/c.go": 0, "sub/deep/d.go": 0,
+	})
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", pattern: "*.go", want: []string{"a.go"}},
+		{name: "double star", pattern: "**/*.go", want: []string{"a.go", "sub/c.go", "sub/deep/d.go"}},
+		{name: "under a dir", pattern: "sub/**/*.go", want: []string{"sub/c.go", "sub/deep/d.go"}},
+		{name: "no dirs", pattern: "*", want: []string{"a.go", "b.txt"}},
+		{name: "missing dir", pattern: "nope/**/*.go", want: []string{}},
+		{name: "bad pattern", pattern: "[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := globFiles(dir, tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("globFiles() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			rel := []string{}
+			for _, g := range got {
+				r, _ := filepath.Rel(dir, g)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			if !tt.wantErr && !slices.Equal(rel, tt.want) {
+				t.Errorf("globFiles() got = %v, want %v", rel, tt.want)
+			}
+		})
+	}
+}
+
+func Test_globFilesRelative(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]time.Duration{"a.go": 0, "sub/c.go": 0, "b.txt": 0})
+	oldPwd, _ := os.Getwd()
+	defer func() {
+		_ = os.Chdir(oldPwd)
+	}()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		pattern string
+		want    []string
+	}{
+		{name: "double star first", dir: ".", pattern: "**/*.go", want: []string{"a.go", "sub/c.go"}},
+		{name: "no dir", dir: "", pattern: "**/*.go", want: []string{"a.go", "sub/c.go"}},
+		{name: "under a dir", dir: ".", pattern: "sub/**/*.go", want: []string{"sub/c.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := globFiles(tt.dir, tt.pattern)
+			if err != nil {
+				t.Fatalf("globFiles() error = %v", err)
+			}
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("globFiles() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_checkUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]time.Duration{
+		"old.c": time.Hour, "new.c": 0, "out.o": time.Minute,
+	})
+
+	tests := []struct {
+		name       string
+		rule       rcparse.CmdEnv
+		wantSkip   bool
+		wantReason string
+	}{
+		{
+			name:       "outputs newer",
+			rule:       rcparse.CmdEnv{Sources: []string{"old.c"}, Generates: []string{"*.o"}, Method: rcparse.MethodMtime},
+			wantSkip:   true,
+			wantReason: "is not newer than",
+		},
+		{
+			name:       "source newer",
+			rule:       rcparse.CmdEnv{Sources: []string{"*.c"}, Generates: []string{"*.o"}, Method: rcparse.MethodMtime},
+			wantReason: "new.c is newer than",
+		},
+		{
+			name:       "output missing",
+			rule:       rcparse.CmdEnv{Sources: []string{"old.c"}, Generates: []string{"*.a"}, Method: rcparse.MethodMtime},
+			wantReason: "nothing matches *.a",
+		},
+		{
+			name:       "no earlier checksum",
+			rule:       rcparse.CmdEnv{Sources: []string{"*.c"}, Method: rcparse.MethodChecksum},
+			wantReason: "no checksum",
+		},
+		{
+			name:       "no sources",
+			rule:       rcparse.CmdEnv{Sources: []string{"*.h"}, Method: rcparse.MethodChecksum},
+			wantReason: "none of its sources exist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Dir = dir
+			got, err := checkUpToDate("r", tt.rule, []string{"cc"}, nil)
+			if err != nil {
+				t.Fatalf("checkUpToDate() error = %v", err)
+			}
+			if got.skip != tt.wantSkip || !strings.Contains(got.reason, tt.wantReason) {
+				t.Errorf("checkUpToDate() got = %v %q, want %v %q", got.skip, got.reason, tt.wantSkip, tt.wantReason)
+			}
+		})
+	}
+}
+
+const UpToDateFile = `
+wf_file:
+  - rule: sum
+    sources: ["*.txt"]
+    c:
+      - echo ran sum
+  - rule: gen
+    sources: ["*.txt"]
+    generates: [out/x]
+    c:
+      - echo ran gen
+  - rule: copy
+    sources: [in.txt]
+    generates: [copy.txt]
+    c:
+      - cp in.txt copy.txt
+`
+
+func TestLocalExecutor_UpToDate(t *testing.T) {
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]time.Duration{"in.txt": time.Hour})
+
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(UpToDateFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+	rcfile.Dir = dir
+
+	tests := []struct {
+		name   string
+		rule   string
+		before func()
+		want   string
+	}{
+		{name: "first run", rule: "sum", want: "ran sum"},
+		{name: "unchanged", rule: "sum", want: "rule sum is up to date: its sources and commands are unchanged"},
+		{
+			name:   "changed",
+			rule:   "sum",
+			before: func() { _ = os.WriteFile(filepath.Join(dir, "in.txt"), []byte("changed"), 0o600) },
+			want:   "rule sum is out of date: its sources or commands changed",
+		},
+		{name: "nothing generated", rule: "gen", want: "rule gen is out of date: nothing matches out/x"},
+		{
+			name:   "generated",
+			rule:   "gen",
+			before: func() { writeFiles(t, dir, map[string]time.Duration{"out/x": -time.Minute}) },
+			want:   "rule gen is up to date",
+		},
+		{name: "runs where it globs", rule: "copy", want: "rule copy is out of date: nothing matches copy.txt"},
+		{name: "copied", rule: "copy", want: "rule copy is up to date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before()
+			}
+			var out bytes.Buffer
+			l := &LocalExecutor{name: "test", stdout: &out, stderr: &out, Verbose: true}
+			if rv, err := l.Run(tt.rule, rcfile); rv != 0 || err != nil {
+				t.Fatalf("Run() = %v, %v", rv, err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("Run() output %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
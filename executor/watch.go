@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stillson/go-wf/rcparse"
+	"github.com/stillson/go-wf/termui"
+)
+
+// DefaultDebounce is how long Watch waits for changes to settle down
+// before running rules again.
+const DefaultDebounce = 200 * time.Millisecond
+
+// errFilesChanged cancels a run that files changed under.
+var errFilesChanged = errors.New("files changed")
+
+// Watch runs rules, and runs them again whenever a file they watch
+// changes, until ctx is cancelled. A rule watches the files matching its
+// watch globs, or else its sources, and those of everything it depends
+// on. Changes are gathered until there have been none for debounce, and
+// a run still going then is stopped before the next one starts.
+func (l *LocalExecutor) Watch(ctx context.Context, rules []string, rcfile rcparse.RCFile, jobs int,
+	debounce time.Duration) error {
+	red, green := termui.GetColorPrints()
+	stdout, _ := l.outputs()
+
+	patterns, err := watchPatterns(rcfile, rules)
+	if err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return errors.New("nothing to watch: give the rules watch or sources globs")
+	}
+
+	w, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = w.Close()
+	}()
+	for _, root := range watchRoots(patterns) {
+		if err := w.Add(root.dir, root.recursive); err != nil {
+			return err
+		}
+	}
+	go w.Run()
+
+	for {
+		runCtx, cancel := context.WithCancelCause(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rv, err := l.RunRules(runCtx, rules, rcfile, jobs)
+			switch {
+			case runCtx.Err() != nil:
+				// stopped for the next run, or for good
+				return
+			case err != nil:
+				_, _ = red.Fprintf(stdout, "%v\n", err)
+			case rv != 0:
+				_, _ = red.Fprintf(stdout, "exited with %v\n", rv)
+			}
+			_, _ = green.Fprintf(stdout, "watching for changes\n")
+		}()
+
+		changed, ok := waitForChanges(ctx, w.Changes, patterns, debounce)
+		if !ok {
+			cancel(context.Cause(ctx))
+			<-done
+			return context.Cause(ctx)
+		}
+
+		cancel(errFilesChanged)
+		<-done
+		_, _ = green.Fprintf(stdout, "%s changed, running again\n", changed)
+	}
+}
+
+// waitForChanges waits for a change to a file matching patterns, and then
+// for there to be no more for debounce. It returns the first file that
+// changed, or false if ctx was cancelled or the watcher stopped first.
+func waitForChanges(ctx context.Context, changes <-chan string, patterns []string,
+	debounce time.Duration) (string, bool) {
+	first := ""
+	var quiet <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-quiet:
+			return first, true
+		case path, ok := <-changes:
+			if !ok {
+				return "", false
+			}
+			if !watched(path, patterns) {
+				continue
+			}
+			if first == "" {
+				first = path
+			}
+			quiet = time.After(debounce)
+		}
+	}
+}
+
+// watchPatterns returns the globs that rules and their dependencies
+// watch, made absolute.
+func watchPatterns(rcfile rcparse.RCFile, rules []string) ([]string, error) {
+	order, err := DepOrder(rcfile, rules...)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := []string{}
+	for _, rule := range order {
+		r, _ := rcfile.GetRule(rule)
+		globs := r.Watch
+		if len(globs) == 0 {
+			globs = r.Sources
+		}
+
+		dir := r.Dir
+		if dir == "" {
+			dir = "."
+		}
+		for _, g := range globs {
+			if !filepath.IsAbs(g) {
+				g = filepath.Join(dir, g)
+			}
+			g, err := filepath.Abs(g)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := filepath.Match(g, ""); err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, g)
+		}
+	}
+	return patterns, nil
+}
+
+type watchRoot struct {
+	dir       string
+	recursive bool
+}
+
+// watchRoots returns the directories to watch for patterns: the part of
+// each before its first wildcard, and everything below that when the
+// wildcards go on into subdirectories.
+func watchRoots(patterns []string) []watchRoot {
+	roots := map[string]bool{}
+	for _, p := range patterns {
+		parts := strings.Split(p, string(filepath.Separator))
+		i := 0
+		for i < len(parts) && !strings.ContainsAny(parts[i], "*?[\\") {
+			i++
+		}
+		if i == len(parts) {
+			i--
+		}
+		dir := strings.Join(parts[:i], string(filepath.Separator))
+		if dir == "" {
+			dir = string(filepath.Separator)
+		}
+		roots[dir] = roots[dir] || len(parts)-i > 1
+	}
+
+	rv := []watchRoot{}
+	for dir, recursive := range roots {
+		rv = append(rv, watchRoot{dir, recursive})
+	}
+	sort.Slice(rv, func(i, j int) bool { return rv[i].dir < rv[j].dir })
+	return rv
+}
+
+// watched reports whether path matches one of patterns. Files wf keeps
+// in StateDir never do.
+func watched(path string, patterns []string) bool {
+	elems := strings.Split(path, string(filepath.Separator))
+	for _, e := range elems {
+		if e == StateDir {
+			return false
+		}
+	}
+	for _, p := range patterns {
+		if matchElems(strings.Split(p, string(filepath.Separator)), elems) {
+			return true
+		}
+	}
+	return false
+}
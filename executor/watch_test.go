@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/stillson/go-wf/rcparse"
+)
+
+func Test_watchRoots(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []watchRoot
+	}{
+		{name: "file", patterns: []string{"/a/b.go"}, want: []watchRoot{{"/a", false}}},
+		{name: "glob", patterns: []string{"/a/*.go"}, want: []watchRoot{{"/a", false}}},
+		{name: "recursive", patterns: []string{"/a/**/*.go"}, want: []watchRoot{{"/a", true}}},
+		{name: "wildcard dir", patterns: []string{"/a/*/x"}, want: []watchRoot{{"/a", true}}},
+		{
+			name:     "merged",
+			patterns: []string{"/a/*.go", "/a/**/*.c", "/b/go.mod"},
+			want:     []watchRoot{{"/a", true}, {"/b", false}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := watchRoots(tt.patterns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("watchRoots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_watched(t *testing.T) {
+	patterns := []string{"/a/**/*.go", "/b/go.mod"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/a/x.go", want: true},
+		{path: "/a/x/y/z.go", want: true},
+		{path: "/a/x.c", want: false},
+		{path: "/b/go.mod", want: true},
+		{path: "/b/go.sum", want: false},
+		{path: "/a/.wf/x.go", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := watched(tt.path, patterns); got != tt.want {
+				t.Errorf("watched() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// syncBuffer is a bytes.Buffer that can be written and read at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLocalExecutor_Watch(t *testing.T) {
+	w, err := newWatcher()
+	if err != nil {
+		t.Skip(err)
+	}
+	_ = w.Close()
+
+	savedNoColor := color.NoColor
+	color.NoColor = true
+	defer func() {
+		color.NoColor = savedNoColor
+	}()
+
+	dir := t.TempDir()
+	rcfile, err := rcparse.CreateYRCFile(strings.NewReader(`
+wf_file:
+  - rule: w
+    watch: ["**/*.txt"]
+    c:
+      - echo ran
+`))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+	rcfile.Dir = dir
+
+	out := &syncBuffer{}
+	l := &LocalExecutor{name: "test", stdout: out, stderr: out}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Watch(ctx, []string{"w"}, rcfile, 1, 20*time.Millisecond)
+	}()
+
+	waitFor := func(want string, count int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for strings.Count(out.String(), want) < count {
+			if time.Now().After(deadline) {
+				t.Fatalf("Watch() output missing %q x%d:\n%s", want, count, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("watching for changes", 1)
+	if err := os.WriteFile(filepath.Join(dir, "ignored.go"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(dir, "sub", "a.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("a.txt changed, running again", 1)
+	waitFor("watching for changes", 2)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not stop")
+	}
+	if strings.Contains(out.String(), "ignored.go") {
+		t.Errorf("Watch() reran for an unwatched file:\n%s", out.String())
+	}
+	if got := strings.Count(out.String(), "\nran\n"); got != 2 {
+		t.Errorf("Watch() ran %d times, want 2:\n%s", got, out.String())
+	}
+}
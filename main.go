@@ -13,9 +13,14 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/stillson/go-wf/termui"
@@ -30,6 +35,45 @@ const (
 	VERSION = "0.0.2"
 )
 
+// Exit codes of wf. When a command fails, wf exits with the command's own
+// exit code instead.
+const (
+	ExitNoRCFile    = 1
+	ExitBadRCFile   = 2
+	ExitNoRule      = 3
+	ExitNoCommand   = 4
+	ExitBadParams   = 5
+	ExitBadTemplate = 6
+	ExitListRules   = 7
+	ExitCantRun     = 8
+)
+
+// exitCode picks what wf exits with, after running rules returned rv
+// and err.
+func exitCode(rv int, err error) int {
+	var exitErr *executor.ExitError
+	var tmplErr *rcparse.TemplateError
+	var coded interface{ ExitCode() int }
+
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.Is(err, rcparse.ErrRuleNotFound):
+		return ExitNoRule
+	case errors.Is(err, executor.ErrCommandNotFound):
+		return ExitNoCommand
+	case errors.As(err, &tmplErr):
+		return ExitBadTemplate
+	case errors.Is(err, executor.ErrDependencyCycle):
+		return ExitBadRCFile
+	case errors.As(err, &coded):
+		return coded.ExitCode()
+	case rv < 0:
+		return ExitCantRun
+	}
+	return rv
+}
+
 func vprint(verbose bool, printGreen bool, format string, inputs ...any) {
 	if !verbose {
 		return
@@ -46,21 +90,47 @@ func printRules(ourRcFile *rcparse.YRCfile) {
 	rules, err := ourRcFile.ListRules()
 	if err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%v", err)
-		os.Exit(7)
+		os.Exit(ExitListRules)
 	}
 
 	for _, rule := range rules {
 		fmt.Printf("%s\n", rule)
+
+		r, _ := ourRcFile.GetRule(rule)
+		for _, p := range r.Params {
+			fmt.Printf("    %s\n", p.Usage())
+		}
 	}
 }
 
+// printEnv shows the environment the commands of rule get.
+func printEnv(ourRcFile *rcparse.YRCfile, rule string) error {
+	env, err := executor.Environ(ourRcFile, rule)
+	if err != nil {
+		return err
+	}
+	r, _ := ourRcFile.GetRule(rule)
+
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("env for %s (env_mode %s):\n", rule, r.EnvMode)
+	for _, k := range keys {
+		fmt.Printf("\t%s=%s\n", k, env[k])
+	}
+	return nil
+}
+
 func dumpRulesFile(f string, verb bool) {
 	red := color.New(color.FgHiRed)
 
 	var fp, err = os.Open(f) //nolint:gosec
 	if err != nil {
 		_, _ = red.Printf("Error reading rcfile:%v\n", err)
-		os.Exit(2)
+		os.Exit(ExitBadRCFile)
 	}
 	defer func() {
 		_ = fp.Close()
@@ -78,81 +148,289 @@ func dumpRulesFile(f string, verb bool) {
 	}
 }
 
-func ParseArgs() (*bool, *bool, *bool, *string, *bool) {
+// checkRulesFile reports every problem rcparse.Check finds in f, and
+// returns what wf should exit with.
+func checkRulesFile(f string) int {
+	red, green := termui.GetColorPrints()
+
+	fp, err := os.Open(f) //nolint:gosec
+	if err != nil {
+		_, _ = red.Printf("Error reading rcfile:%v\n", err)
+		return ExitBadRCFile
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	if err := rcparse.Check(fp, f); err != nil {
+		_, _ = red.Printf("%v\n", err)
+		return ExitBadRCFile
+	}
+	_, _ = green.Printf("%s: ok\n", f)
+	return 0
+}
+
+type Options struct {
+	Verbose bool
+	Time    bool
+	Dump    bool
+	WfFile  string
+	// WfFileSet is whether WfFile was given, rather than the default.
+	WfFileSet bool
+	Rules     bool
+	Jobs      int
+	Grace     time.Duration
+	Watch     bool
+	Check     bool
+	Layers    bool
+}
+
+// splitRulesArgs splits the positional arguments into the rules to run
+// and the extra arguments passed on to them. The first argument is always
+// a rule, and is followed by any other arguments naming rules. Everything
+// from the first argument that isn't a rule, or after a "--", is passed on.
+func splitRulesArgs(ourRcFile *rcparse.YRCfile, args []string) ([]string, []string) {
+	if len(args) == 0 {
+		return []string{}, []string{}
+	}
+
+	i := 1
+	for ; i < len(args); i++ {
+		if args[i] == "--" {
+			return args[:i], args[i+1:]
+		}
+		if _, exists := ourRcFile.GetRule(args[i]); !exists {
+			break
+		}
+	}
+	return args[:i], args[i:]
+}
+
+func ParseArgs() Options {
+	var opts Options
+
 	// flags
 	versionQ := flag.Bool("v", false, "Version of this program")
-	verboseQ := flag.Bool("V", false, "Verbose output")
-	timeQ := flag.Bool("t", false, "Time the command")
-	dumpQ := flag.Bool("d", false, "Dump contents of workflow file")
-	wfFile := flag.String("f", ".workflow.yaml", "Name of workflow file")
-	ruleQ := flag.Bool("r", false, "Print available rules")
+	flag.BoolVar(&opts.Verbose, "V", false, "Verbose output")
+	flag.BoolVar(&opts.Time, "t", false, "Time the command")
+	flag.BoolVar(&opts.Dump, "d", false, "Dump contents of workflow file")
+	flag.StringVar(&opts.WfFile, "f", ".workflow.yaml", "Name of workflow file")
+	flag.BoolVar(&opts.Rules, "r", false, "Print available rules")
+	flag.IntVar(&opts.Jobs, "j", 1, "Number of rules to run at once")
+	flag.DurationVar(&opts.Grace, "grace", executor.DefaultGracePeriod,
+		"Time an interrupted command gets to exit before it is killed")
+	flag.BoolVar(&opts.Watch, "w", false, "Run the rules again whenever the files they watch change")
+	flag.BoolVar(&opts.Layers, "layers", false, "Print the workflow files read, and where each rule came from")
+	flag.BoolVar(&opts.Check, "check", false, "Check the workflow file for mistakes, without running anything")
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "f" {
+			opts.WfFileSet = true
+		}
+	})
 
 	if *versionQ {
 		fmt.Printf("wf version %v\n", VERSION)
 		os.Exit(0)
 	}
-	return verboseQ, timeQ, dumpQ, wfFile, ruleQ
+	return opts
+}
+
+// loadLayers reads the workflow files of layers. Rules run in the
+// directory of the project's workflow file, or else the current one.
+func loadLayers(layers []rcfile.Layer) (*rcparse.YRCfile, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(layers))
+	for _, l := range layers {
+		if l.Name == rcfile.LayerProject {
+			dir = filepath.Dir(l.File)
+		}
+		files = append(files, l.File)
+	}
+	return rcparse.NewLayeredYRCFile(dir, files...)
+}
+
+// printLayers shows the workflow files read, and which one each rule
+// came from.
+func printLayers(layers []rcfile.Layer, ourRcFile *rcparse.YRCfile) {
+	for _, l := range layers {
+		fmt.Printf("%-8s %s\n", l.Name, l.File)
+	}
+
+	rules, err := ourRcFile.ListRules()
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "%v", err)
+		os.Exit(ExitListRules)
+	}
+	width := 0
+	for _, rule := range rules {
+		width = max(width, len(rule))
+	}
+	fmt.Println()
+	for _, rule := range rules {
+		r, _ := ourRcFile.GetRule(rule)
+		fmt.Printf("%-*s  %s\n", width, rule, r.File)
+	}
+}
+
+// isSchemaCmd reports whether wf was asked for the schema of workflow
+// files, with "wf schema". A rule called schema wins.
+func isSchemaCmd(wfFile string) bool {
+	if flag.NArg() != 1 || flag.Arg(0) != "schema" {
+		return false
+	}
+	layers, err := rcfile.Layers(wfFile, false)
+	if err != nil {
+		return true
+	}
+	rc, err := loadLayers(layers)
+	if err != nil {
+		return true
+	}
+	_, exists := rc.GetRule("schema")
+	return !exists
 }
 
 func main() {
-	verboseQ, timeQ, dumpQ, wfFile, ruleQ := ParseArgs()
+	opts := ParseArgs()
+
+	if isSchemaCmd(opts.WfFile) {
+		schema, err := rcparse.Schema()
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(ExitBadRCFile)
+		}
+		_, _ = os.Stdout.Write(schema)
+		return
+	}
 
-	vprint(*verboseQ, false, "Verbose is on\n")
-	vprint(*timeQ && *verboseQ, false, "Timing enabled\n")
-	vprint(*dumpQ && *verboseQ, false, "Dumping workflow file\n")
-	vprint(*verboseQ, false, "File to search for: %s\n", *wfFile)
+	vprint(opts.Verbose, false, "Verbose is on\n")
+	vprint(opts.Time && opts.Verbose, false, "Timing enabled\n")
+	vprint(opts.Dump && opts.Verbose, false, "Dumping workflow file\n")
+	vprint(opts.Verbose, false, "File to search for: %s\n", opts.WfFile)
 
 	// set up colors
 	red, green := termui.GetColorPrints()
 
-	// get filename of rcfile
-	f, err := rcfile.GetRCFile(*wfFile)
+	// get filenames of the rcfiles
+	layers, err := rcfile.Layers(opts.WfFile, opts.WfFileSet)
 	if err != nil {
 		_, _ = red.Printf("Error getting rcfile:%v\n", err)
-		os.Exit(1)
+		os.Exit(ExitNoRCFile)
+	}
+	for _, l := range layers {
+		vprint(opts.Verbose, false, "Actual file found: %s (%s)\n", l.File, l.Name)
 	}
-	vprint(*verboseQ, false, "Actual file found: %s\n", f)
 
-	if *dumpQ {
-		dumpRulesFile(f, *verboseQ)
+	if opts.Dump {
+		for _, l := range layers {
+			dumpRulesFile(l.File, opts.Verbose)
+		}
 		return
 	}
 
-	ourRcFile, err := rcparse.NewYRCFile(f)
+	if opts.Check {
+		rv := 0
+		for _, l := range layers {
+			if code := checkRulesFile(l.File); code != 0 {
+				rv = code
+			}
+		}
+		os.Exit(rv)
+	}
+
+	ourRcFile, err := loadLayers(layers)
 	if err != nil {
 		_, _ = red.Printf("Error parsing rcfile:%v\n", err)
-		os.Exit(2)
+		os.Exit(ExitBadRCFile)
 	}
-	vprint(*verboseQ, false, "\tRC: %v\n", ourRcFile)
+	vprint(opts.Verbose, false, "\tRC: %v\n", ourRcFile)
 
-	if *ruleQ {
+	if opts.Layers {
+		printLayers(layers, ourRcFile)
+		return
+	}
+
+	if opts.Rules {
 		printRules(ourRcFile)
 		return
 	}
 
-	rule := flag.Arg(0)
-	vprint(*verboseQ, false, "rule is: %s\n", rule)
+	rules, args := splitRulesArgs(ourRcFile, flag.Args())
+	if len(rules) == 0 {
+		_, _ = red.Printf("no rule given\n")
+		os.Exit(ExitNoRule)
+	}
+	vprint(opts.Verbose, false, "rules are: %v\n", rules)
+	vprint(opts.Verbose && len(args) > 0, false, "args are: %v\n", args)
+
+	for _, rule := range rules {
+		if err := ourRcFile.SetArgs(rule, args); err != nil {
+			_, _ = red.Printf("%v\n", err)
+			os.Exit(ExitBadParams)
+		}
+	}
+
+	// dependencies get no arguments, so their parameters are checked now
+	// rather than when they are reached
+	order, err := executor.DepOrder(ourRcFile, rules...)
+	if err != nil {
+		_, _ = red.Printf("%v\n", err)
+		os.Exit(exitCode(-1, err))
+	}
+	for _, rule := range order {
+		if slices.Contains(rules, rule) {
+			continue
+		}
+		if err := ourRcFile.SetArgs(rule, nil); err != nil {
+			_, _ = red.Printf("%v\n", err)
+			os.Exit(ExitBadParams)
+		}
+	}
+
+	if opts.Verbose {
+		for _, rule := range order {
+			if err := printEnv(ourRcFile, rule); err != nil {
+				_, _ = red.Printf("%v\n", err)
+				os.Exit(exitCode(-1, err))
+			}
+		}
+	}
 
 	var now int64
-	if *timeQ {
+	if opts.Time {
 		now = time.Now().UnixMicro()
-		vprint(*verboseQ, true, "Start time: %v\n", now)
+		vprint(opts.Verbose, true, "Start time: %v\n", now)
 	}
 
+	ctx, stop := executor.WithSignals(context.Background())
+
 	localExec := executor.NewLocalExec("main")
-	rv, err := localExec.Run(rule, ourRcFile)
+	localExec.GracePeriod = opts.Grace
+	localExec.Verbose = opts.Verbose
+	var rv int
+	if opts.Watch {
+		rv, err = -1, localExec.Watch(ctx, rules, ourRcFile, opts.Jobs, executor.DefaultDebounce)
+	} else {
+		rv, err = localExec.RunRules(ctx, rules, ourRcFile, opts.Jobs)
+	}
+	stop()
 	if err != nil {
 		_, _ = red.Printf("%v\n", err)
 	}
 
-	if *timeQ {
+	if opts.Time {
 		end := time.Now().UnixMicro()
-		vprint(*verboseQ, true, "End time: %v\n", end)
+		vprint(opts.Verbose, true, "End time: %v\n", end)
 		_, _ = green.Printf("Total Time in µsecs: %v\n", end-now)
 	}
 
+	rv = exitCode(rv, err)
 	if rv != 0 {
 		_, _ = red.Printf("\nProcess exited with %v\n", rv)
 	}
@@ -13,13 +13,19 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 
+	"github.com/stillson/go-wf/executor"
+	"github.com/stillson/go-wf/rcfile"
 	"github.com/stillson/go-wf/rcparse"
 )
 
@@ -32,6 +38,7 @@ func TestParseArgs(t *testing.T) {
 		dump    bool
 		wfFile  string
 		rules   bool
+		jobs    int
 	}{
 		{
 			name:    "test1",
@@ -41,6 +48,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    false,
 			wfFile:  ".workflow.yaml",
 			rules:   false,
+			jobs:    1,
 		},
 		{
 			name:    "test2",
@@ -50,6 +58,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    false,
 			wfFile:  "TESTNAME",
 			rules:   false,
+			jobs:    1,
 		},
 		{
 			name:    "test3",
@@ -59,6 +68,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    false,
 			wfFile:  ".workflow.yaml",
 			rules:   false,
+			jobs:    1,
 		},
 
 		{
@@ -69,6 +79,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    false,
 			wfFile:  ".workflow.yaml",
 			rules:   false,
+			jobs:    1,
 		},
 		{
 			name:    "test5",
@@ -78,6 +89,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    true,
 			wfFile:  ".workflow.yaml",
 			rules:   false,
+			jobs:    1,
 		},
 		{
 			name:    "test6",
@@ -87,6 +99,7 @@ func TestParseArgs(t *testing.T) {
 			dump:    false,
 			wfFile:  ".workflow.yaml",
 			rules:   true,
+			jobs:    1,
 		},
 		{
 			name:    "test7",
@@ -96,26 +109,40 @@ func TestParseArgs(t *testing.T) {
 			dump:    true,
 			wfFile:  "TESTNAME",
 			rules:   true,
+			jobs:    1,
+		},
+		{
+			name:    "test8",
+			newArgs: []string{"wf", "-j", "4", "lint", "test"},
+			verbose: false,
+			time:    false,
+			dump:    false,
+			wfFile:  ".workflow.yaml",
+			rules:   false,
+			jobs:    4,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			os.Args = tt.newArgs
-			got, got1, got2, got3, got4 := ParseArgs()
-			if !reflect.DeepEqual(*got, tt.verbose) {
-				t.Errorf("ParseArgs() got = %v, verbose %v", got, tt.verbose)
+			got := ParseArgs()
+			if !reflect.DeepEqual(got.Verbose, tt.verbose) {
+				t.Errorf("ParseArgs() Verbose = %v, verbose %v", got.Verbose, tt.verbose)
+			}
+			if !reflect.DeepEqual(got.Time, tt.time) {
+				t.Errorf("ParseArgs() Time = %v, verbose %v", got.Time, tt.time)
 			}
-			if !reflect.DeepEqual(*got1, tt.time) {
-				t.Errorf("ParseArgs() got1 = %v, verbose %v", got1, tt.time)
+			if !reflect.DeepEqual(got.Dump, tt.dump) {
+				t.Errorf("ParseArgs() Dump = %v, verbose %v", got.Dump, tt.dump)
 			}
-			if !reflect.DeepEqual(*got2, tt.dump) {
-				t.Errorf("ParseArgs() got2 = %v, verbose %v", got2, tt.dump)
+			if !reflect.DeepEqual(got.WfFile, tt.wfFile) {
+				t.Errorf("ParseArgs() WfFile = %v, verbose %v", got.WfFile, tt.wfFile)
 			}
-			if !reflect.DeepEqual(*got3, tt.wfFile) {
-				t.Errorf("ParseArgs() got3 = %v, verbose %v", got3, tt.wfFile)
+			if !reflect.DeepEqual(got.Rules, tt.rules) {
+				t.Errorf("ParseArgs() Rules = %v, verbose %v", got.Rules, tt.rules)
 			}
-			if !reflect.DeepEqual(*got4, tt.rules) {
-				t.Errorf("ParseArgs() got4 = %v, verbose %v", got4, tt.rules)
+			if !reflect.DeepEqual(got.Jobs, tt.jobs) {
+				t.Errorf("ParseArgs() Jobs = %v, verbose %v", got.Jobs, tt.jobs)
 			}
 
 			// to reset flag module so it can be reused
@@ -249,3 +276,243 @@ func Test_printRules(t *testing.T) {
 		})
 	}
 }
+
+func Test_splitRulesArgs(t *testing.T) {
+	commands := map[string]rcparse.CmdEnv{}
+	commands["lint"] = rcparse.CmdEnv{}
+	commands["test"] = rcparse.CmdEnv{}
+
+	x := rcparse.YRCfile{
+		G:        map[string]string{},
+		Commands: commands,
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		wantRules []string
+		wantArgs  []string
+	}{
+		{
+			name:      "nothing",
+			args:      []string{},
+			wantRules: []string{},
+			wantArgs:  []string{},
+		},
+		{
+			name:      "one rule",
+			args:      []string{"test"},
+			wantRules: []string{"test"},
+			wantArgs:  []string{},
+		},
+		{
+			name:      "several rules",
+			args:      []string{"lint", "test"},
+			wantRules: []string{"lint", "test"},
+			wantArgs:  []string{},
+		},
+		{
+			name:      "rule and args",
+			args:      []string{"test", "-run", "TestFoo", "./pkg/..."},
+			wantRules: []string{"test"},
+			wantArgs:  []string{"-run", "TestFoo", "./pkg/..."},
+		},
+		{
+			name:      "rule names after args",
+			args:      []string{"test", "-v", "lint"},
+			wantRules: []string{"test"},
+			wantArgs:  []string{"-v", "lint"},
+		},
+		{
+			name:      "separator",
+			args:      []string{"test", "--", "lint"},
+			wantRules: []string{"test"},
+			wantArgs:  []string{"lint"},
+		},
+		{
+			name:      "unknown rule",
+			args:      []string{"nope", "test"},
+			wantRules: []string{"nope", "test"},
+			wantArgs:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRules, gotArgs := splitRulesArgs(&x, tt.args)
+			if !reflect.DeepEqual(gotRules, tt.wantRules) {
+				t.Errorf("splitRulesArgs() rules = %v, want %v", gotRules, tt.wantRules)
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("splitRulesArgs() args = %v, want %v", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func Test_printEnv(t *testing.T) {
+	t.Setenv("WF_TEST_PASS", "passed")
+	x, err := rcparse.CreateYRCFile(strings.NewReader(`
+env:
+  B: top
+  A: top
+wf_file:
+  - rule: test
+    env_mode: clean
+    env:
+      B: rule
+    c:
+      - echo
+  - rule: allow
+    env_mode: allowlist
+    env_pass: [WF_TEST_PASS]
+    c:
+      - echo
+`))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "test",
+			rule: "test",
+			want: "env for test (env_mode clean):\n\tA=top\n\tB=rule\n",
+		},
+		{
+			name: "allowlist",
+			rule: "allow",
+			want: "env for allow (env_mode allowlist):\n\tA=top\n\tB=top\n\tWF_TEST_PASS=passed\n",
+		},
+		{
+			name:    "missing",
+			rule:    "missing",
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, _ := os.Pipe()
+
+			savedOut := os.Stdout
+			os.Stdout = w
+			err := printEnv(x, tt.rule)
+
+			outC := make(chan string)
+			go func() {
+				buf := bytes.Buffer{}
+				_, _ = io.Copy(&buf, r)
+				outC <- buf.String()
+			}()
+
+			_ = w.Close()
+			os.Stdout = savedOut
+			out := <-outC
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("printEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if out != tt.want {
+				t.Errorf("printEnv() got1 = %v, verbose %v", out, tt.want)
+			}
+		})
+	}
+}
+
+func Test_exitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		rv   int
+		err  error
+		want int
+	}{
+		{name: "success", rv: 0, err: nil, want: 0},
+		{name: "command exit", rv: 2, err: fmt.Errorf("rule a: %w", &executor.ExitError{Code: 2}), want: 2},
+		{name: "rule not found", rv: -1, err: fmt.Errorf("%w: a", rcparse.ErrRuleNotFound), want: ExitNoRule},
+		{name: "command not found", rv: -1, err: fmt.Errorf("%w: a", executor.ErrCommandNotFound), want: ExitNoCommand},
+		{name: "template", rv: -1, err: &rcparse.TemplateError{Rule: "a", Line: 1}, want: ExitBadTemplate},
+		{name: "timeout", rv: 124, err: executor.Timeout{What: "rule a"}, want: executor.TimeoutExitCode},
+		{name: "interrupt", rv: 130, err: executor.Interrupt{Signal: syscall.SIGINT}, want: 130},
+		{name: "joined", rv: 1, err: errors.Join(errors.New("other"), &executor.ExitError{Code: 1}), want: 1},
+		{name: "killed", rv: 137, err: &executor.ExitError{Code: 137, Signal: syscall.SIGKILL}, want: 137},
+		{name: "cycle", rv: -1, err: fmt.Errorf("%w: a -> a", executor.ErrDependencyCycle), want: ExitBadRCFile},
+		{name: "no executor", rv: -1, err: fmt.Errorf("rule a: %w: b", executor.ErrExecutorNotFound), want: ExitCantRun},
+		{name: "other", rv: -1, err: errors.New("stdin for cat: no such file"), want: ExitCantRun},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.rv, tt.err); got != tt.want {
+				t.Errorf("exitCode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadLayers(t *testing.T) {
+	user, project, cwd := t.TempDir(), t.TempDir(), t.TempDir()
+	userFile := filepath.Join(user, "workflow.yaml")
+	projectFile := filepath.Join(project, ".workflow.yaml")
+	if err := os.WriteFile(userFile, []byte("wf_file:\n  - rule: mark\n    c: [touch user-rule]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(projectFile, []byte("wf_file:\n  - rule: build\n    c: [touch project-rule]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	oldPwd, _ := os.Getwd()
+	defer func() {
+		_ = os.Chdir(oldPwd)
+	}()
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		layers []rcfile.Layer
+		rule   string
+		want   string
+	}{
+		{
+			name:   "project rule",
+			layers: []rcfile.Layer{{Name: rcfile.LayerUser, File: userFile}, {Name: rcfile.LayerProject, File: projectFile}},
+			rule:   "build",
+			want:   filepath.Join(project, "project-rule"),
+		},
+		{
+			name:   "user rule",
+			layers: []rcfile.Layer{{Name: rcfile.LayerUser, File: userFile}, {Name: rcfile.LayerProject, File: projectFile}},
+			rule:   "mark",
+			want:   filepath.Join(project, "user-rule"),
+		},
+		{
+			name:   "no project",
+			layers: []rcfile.Layer{{Name: rcfile.LayerUser, File: userFile}},
+			rule:   "mark",
+			want:   filepath.Join(cwd, "user-rule"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := loadLayers(tt.layers)
+			if err != nil {
+				t.Fatalf("loadLayers() error = %v", err)
+			}
+			ex := executor.NewLocalExec("test")
+			if rv, err := ex.Run(tt.rule, rc); rv != 0 || err != nil {
+				t.Fatalf("Run() = %v, %v", rv, err)
+			}
+			if _, err := os.Stat(tt.want); err != nil {
+				t.Errorf("rule %s did not run in %s: %v", tt.rule, filepath.Dir(tt.want), err)
+			}
+			if _, err := os.Stat(filepath.Join(user, filepath.Base(tt.want))); err == nil {
+				t.Errorf("rule %s ran in the user's directory", tt.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The layers of configuration wf reads, in order. Later layers win.
+const (
+	// LayerUser is the user's defaults, see UserRCFile.
+	LayerUser = "user"
+	// LayerProject is the workflow file found by GetRCFile.
+	LayerProject = "project"
+	// LayerLocal is the untracked override file next to the project's,
+	// see LocalRCFile.
+	LayerLocal = "local"
+)
+
+// Layer is one of the workflow files wf reads.
+type Layer struct {
+	// Name is LayerUser, LayerProject or LayerLocal.
+	Name string
+	File string
+}
+
+// UserRCFile returns where the user's default workflow file is:
+// wf/workflow.yaml in $XDG_CONFIG_HOME, or in ~/.config if that isn't set.
+func UserRCFile() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "wf", "workflow.yaml"), nil
+}
+
+// LocalRCFile returns the name of the local override file of the
+// workflow file project, e.g. .workflow.local.yaml for .workflow.yaml.
+func LocalRCFile(project string) string {
+	ext := filepath.Ext(project)
+	if ext == "" || ext == filepath.Base(project) {
+		return project + ".local"
+	}
+	return strings.TrimSuffix(project, ext) + ".local" + ext
+}
+
+// Layers returns the workflow files there are to read, in order: the
+// user's defaults, the project's workflow file fname found by GetRCFile,
+// and its local override file. Any of them can be missing, but not all,
+// and not the project's when required is set, as when it was named.
+func Layers(fname string, required bool) ([]Layer, error) {
+	layers := []Layer{}
+
+	if user, err := UserRCFile(); err == nil && isFile(user) {
+		layers = append(layers, Layer{Name: LayerUser, File: user})
+	}
+
+	project, err := GetRCFile(fname)
+	switch {
+	case err == nil:
+		layers = append(layers, Layer{Name: LayerProject, File: project})
+		if local := LocalRCFile(project); isFile(local) {
+			layers = append(layers, Layer{Name: LayerLocal, File: local})
+		}
+	case required || !errors.Is(err, ErrNotFound):
+		return nil, fmt.Errorf("%s: %w", fname, err)
+	}
+
+	if len(layers) == 0 {
+		return nil, ErrNotFound
+	}
+	return layers, nil
+}
+
+func isFile(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
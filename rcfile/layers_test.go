@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcfile
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLocalRCFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		want    string
+	}{
+		{name: "default", project: "/p/.workflow.yaml", want: "/p/.workflow.local.yaml"},
+		{name: "yml", project: "/p/wf.yml", want: "/p/wf.local.yml"},
+		{name: "no extension", project: "/p/.workflowrc", want: "/p/.workflowrc.local"},
+		{name: "plain", project: "/p/workflow", want: "/p/workflow.local"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LocalRCFile(tt.project); got != tt.want {
+				t.Errorf("LocalRCFile() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserRCFile(t *testing.T) {
+	tests := []struct {
+		name string
+		xdg  string
+		home string
+		want string
+	}{
+		{name: "xdg", xdg: "/xdg", home: "/home/me", want: "/xdg/wf/workflow.yaml"},
+		{name: "unset", xdg: "", home: "/home/me", want: "/home/me/.config/wf/workflow.yaml"},
+		{name: "relative", xdg: "xdg", home: "/home/me", want: "/home/me/.config/wf/workflow.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdg)
+			t.Setenv("HOME", tt.home)
+			got, err := UserRCFile()
+			if err != nil || got != tt.want {
+				t.Errorf("UserRCFile() got = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayers(t *testing.T) {
+	dir := t.TempDir()
+	oldPwd, _ := os.Getwd()
+	defer func() {
+		_ = os.Chdir(oldPwd)
+	}()
+
+	write := func(name string) string {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("wf_file: []\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	user := write("config/wf/workflow.yaml")
+	project := write("both/.workflow.yaml")
+	local := write("both/.workflow.local.yaml")
+	alone := write("alone/.workflow.yaml")
+	if err := os.Mkdir(filepath.Join(dir, "none"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		dir      string
+		xdg      string
+		required bool
+		want     []Layer
+		wantErr  bool
+	}{
+		{
+			name: "all",
+			dir:  "both",
+			xdg:  filepath.Join(dir, "config"),
+			want: []Layer{{LayerUser, user}, {LayerProject, project}, {LayerLocal, local}},
+		},
+		{
+			name: "no user file",
+			dir:  "both",
+			xdg:  filepath.Join(dir, "nothere"),
+			want: []Layer{{LayerProject, project}, {LayerLocal, local}},
+		},
+		{
+			name: "no local file",
+			dir:  "alone",
+			xdg:  filepath.Join(dir, "nothere"),
+			want: []Layer{{LayerProject, alone}},
+		},
+		{
+			name: "user file only",
+			dir:  "none",
+			xdg:  filepath.Join(dir, "config"),
+			want: []Layer{{LayerUser, user}},
+		},
+		{
+			name:     "named file missing",
+			dir:      "none",
+			xdg:      filepath.Join(dir, "config"),
+			required: true,
+			wantErr:  true,
+		},
+		{
+			name:     "named file",
+			dir:      "alone",
+			xdg:      filepath.Join(dir, "config"),
+			required: true,
+			want:     []Layer{{LayerUser, user}, {LayerProject, alone}},
+		},
+		{
+			name:    "nothing",
+			dir:     "none",
+			xdg:     filepath.Join(dir, "nothere"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", tt.xdg)
+			if err := os.Chdir(filepath.Join(dir, tt.dir)); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Layers(".workflow.yaml", tt.required)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Layers() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Layers() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
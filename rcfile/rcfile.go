@@ -14,11 +14,14 @@
 package rcfile
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"path"
 )
 
+// ErrNotFound is returned when there is no workflow file to be found.
+var ErrNotFound = errors.New("workflow file not found")
+
 // for now, just get full path to ./.workflow.yaml
 // later, search parents, copy in a default if needed
 // hmmm, how to test
@@ -54,6 +57,6 @@ func GetRCFile(fname string) (string, error) {
 		return rcCandidate, nil
 	}
 
-	return "", fmt.Errorf("workflow file not found")
+	return "", ErrNotFound
 
 }
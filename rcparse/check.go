@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"gopkg.in/yaml.v3"
+)
+
+// Check reads the workflow file file from r, more strictly than Parse.
+// Besides what Parse rejects, it reports unknown keys, rules defined twice
+// in a document, rules with neither commands nor dependencies, and command
+// templates that don't parse. All the problems found are returned, joined, as *CheckError.
+func Check(r io.Reader, file string) error {
+	c := checker{file: file}
+	rc := newYRCfile()
+	rc.Dir = filepath.Dir(file)
+	if abs, err := filepath.Abs(file); err == nil {
+		rc.including = []string{abs}
+	}
+
+	dec := yaml.NewDecoder(r)
+	docs := 0
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.yamlError(err)
+			break
+		}
+		docs++
+
+		root := resolve(&doc)
+		c.keys(root, reflect.TypeOf(YRCFormat{}))
+		c.rules(root)
+		c.templates(root)
+
+		var entries YRCFormat
+		if err := doc.Decode(&entries); err != nil {
+			c.yamlError(err)
+			continue
+		}
+		if err := rc.add(entries); err != nil && !errors.Is(err, errRuleTwice) {
+			c.add(addErrorNode(root, err), "%v", err)
+		}
+	}
+	if docs == 0 && len(c.errs) == 0 {
+		c.errs = append(c.errs, &CheckError{File: file, Line: 1, Msg: "empty rc file"})
+	}
+
+	slices.SortStableFunc(c.errs, func(a, b *CheckError) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Col - b.Col
+	})
+	errs := make([]error, len(c.errs))
+	for i, e := range c.errs {
+		errs[i] = e
+	}
+	return errors.Join(errs...)
+}
+
+type checker struct {
+	file string
+	errs []*CheckError
+}
+
+func (c *checker) add(n *yaml.Node, format string, a ...any) {
+	c.errs = append(c.errs, &CheckError{File: c.file, Line: n.Line, Col: n.Column, Msg: fmt.Sprintf(format, a...)})
+}
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError turns the errors of the yaml package, which only know the
+// line, into CheckErrors.
+func (c *checker) yamlError(err error) {
+	msgs := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		msgs = typeErr.Errors
+	}
+
+	for _, msg := range msgs {
+		line := 1
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = m[2]
+		}
+		c.errs = append(c.errs, &CheckError{File: c.file, Line: line, Msg: strings.TrimPrefix(msg, "yaml: ")})
+	}
+}
+
+// addErrorNode returns the node of root that err, from add, is about.
+// Rules defined twice are left to rules to report.
+func addErrorNode(root *yaml.Node, err error) *yaml.Node {
+	var incErr *includeError
+	if errors.As(err, &incErr) {
+		if n := value(root, "include"); n != nil {
+			return n
+		}
+		return root
+	}
+
+	var ruleErr *ruleError
+	if items := value(root, "wf_file"); errors.As(err, &ruleErr) && items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			if name := value(resolve(item), "rule"); name != nil && name.Value == ruleErr.rule {
+				return name
+			}
+		}
+	}
+	return root
+}
+
+// resolve follows document and alias nodes to the node holding the value.
+func resolve(n *yaml.Node) *yaml.Node {
+	for n != nil {
+		switch {
+		case n.Kind == yaml.DocumentNode && len(n.Content) > 0:
+			n = n.Content[0]
+		case n.Kind == yaml.AliasNode:
+			n = n.Alias
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// keys reports the keys of mappings in n that t has no field for.
+func (c *checker) keys(n *yaml.Node, t reflect.Type) {
+	n = resolve(n)
+	if n == nil {
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t, map[string]reflect.Type{})
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				continue
+			}
+			ft, ok := fields[key.Value]
+			if !ok {
+				c.add(key, "unknown key %q", key.Value)
+				continue
+			}
+			c.keys(value, ft)
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			return
+		}
+		for _, item := range n.Content {
+			c.keys(item, t.Elem())
+		}
+
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 1; i < len(n.Content); i += 2 {
+			c.keys(n.Content[i], t.Elem())
+		}
+	}
+}
+
+// yamlFields adds the keys the yaml package maps to the fields of t, and
+// their types, to fields.
+func yamlFields(t reflect.Type, fields map[string]reflect.Type) map[string]reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		switch {
+		case name == "-":
+		case strings.Contains(opts, "inline"):
+			yamlFields(f.Type, fields)
+		case !f.IsExported():
+		case name == "":
+			fields[strings.ToLower(f.Name)] = f.Type
+		default:
+			fields[name] = f.Type
+		}
+	}
+	return fields
+}
+
+// value returns the value of key in the mapping n, or nil.
+func value(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolve(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// rules reports rules without a name, rules with neither commands nor
+// dependencies, and rules defined twice.
+func (c *checker) rules(root *yaml.Node) {
+	items := value(root, "wf_file")
+	if items == nil || items.Kind != yaml.SequenceNode {
+		return
+	}
+
+	seen := map[string]*yaml.Node{}
+	for _, item := range items.Content {
+		item = resolve(item)
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+
+		name := value(item, "rule")
+		if name == nil || name.Value == "" {
+			c.add(item, "rule without a name")
+			continue
+		}
+		if first, ok := seen[name.Value]; ok {
+			c.add(name, "rule %s defined again, first at %d:%d", name.Value, first.Line, first.Column)
+		} else {
+			seen[name.Value] = name
+		}
+
+		cmds := value(item, "c")
+		script := value(item, "script")
+		deps := value(item, "deps")
+		if (cmds == nil || len(cmds.Content) == 0) && (script == nil || script.Value == "") &&
+			(deps == nil || len(deps.Content) == 0) {
+			c.add(name, "rule %s has no commands", name.Value)
+		}
+	}
+}
+
+// templates reports the command templates in root that don't parse.
+func (c *checker) templates(root *yaml.Node) {
+	lists := func(n *yaml.Node) []*yaml.Node {
+		rv := []*yaml.Node{}
+		for _, hook := range []string{HookBefore, HookAfter, HookOnFailure, HookFinally} {
+			rv = append(rv, value(n, hook))
+		}
+		return rv
+	}
+
+	cmdLists := lists(root)
+	if items := value(root, "wf_file"); items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			item = resolve(item)
+			cmdLists = append(cmdLists, value(item, "c"))
+			cmdLists = append(cmdLists, lists(item)...)
+			if script := value(item, "script"); script != nil {
+				c.template(script)
+			}
+		}
+	}
+
+	for _, list := range cmdLists {
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, cmd := range list.Content {
+			cmd = resolve(cmd)
+			if cmd.Kind == yaml.MappingNode {
+				cmd = value(cmd, "cmd")
+			}
+			if cmd != nil {
+				c.template(cmd)
+			}
+		}
+	}
+}
+
+func (c *checker) template(n *yaml.Node) {
+	if n.Kind != yaml.ScalarNode {
+		return
+	}
+	if _, err := template.New("Cmd").Funcs(sprig.FuncMap()).Parse(n.Value); err != nil {
+		c.add(n, "bad template: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			name: "ok",
+			yaml: "vars: {x: y}\nwf_file:\n  - rule: a\n    c:\n      - echo {{.V.x}}\n      - cmd: sleep 1\n        timeout: 1s\n",
+			want: nil,
+		},
+		{
+			name: "unknown keys",
+			yaml: "envs: {A: b}\nwf_file:\n  - rule: a\n    cmd:\n      - echo\n    c: [echo]\n" +
+				"  - rule: b\n    c:\n      - cmd: echo\n        timout: 1s\n    params:\n      - name: x\n        typ: int\n",
+			want: []string{
+				`test.yaml:1:1: unknown key "envs"`,
+				`test.yaml:4:5: unknown key "cmd"`,
+				`test.yaml:10:9: unknown key "timout"`,
+				`test.yaml:13:9: unknown key "typ"`,
+			},
+		},
+		{
+			name: "duplicate rule",
+			yaml: "wf_file:\n  - rule: a\n    c: [echo]\n  - rule: a\n    c: [echo]\n",
+			want: []string{"test.yaml:4:11: rule a defined again, first at 2:11"},
+		},
+		{
+			name: "rule again in a later document",
+			yaml: "wf_file:\n  - rule: a\n    c: [echo]\n---\nwf_file:\n  - rule: a\n    c: [echo]\n",
+			want: nil,
+		},
+		{
+			name: "no commands",
+			yaml: "wf_file:\n  - rule: a\n  - rule: b\n    c: []\n  - rule: c\n    script: echo\n  - c: [echo]\n" +
+				"  - rule: d\n    deps: [c]\n",
+			want: []string{
+				"test.yaml:2:11: rule a has no commands",
+				"test.yaml:3:11: rule b has no commands",
+				"test.yaml:7:5: rule without a name",
+			},
+		},
+		{
+			name: "bad templates",
+			yaml: "finally: ['{{.Failed']\nwf_file:\n  - rule: a\n    c:\n      - echo {{if}}\n      - cmd: '{{end}}'\n" +
+				"    script: '{{nosuchfunc}}'\n",
+			want: []string{
+				"test.yaml:1:11: bad template: template: Cmd:1: unclosed action",
+				"test.yaml:5:9: bad template: template: Cmd:1: missing value for if",
+				"test.yaml:6:14: bad template: template: Cmd:1: unexpected {{end}}",
+				`test.yaml:7:13: bad template: template: Cmd:1: function "nosuchfunc" not defined`,
+			},
+		},
+		{
+			name: "bad type",
+			yaml: "wf_file:\n  - rule: a\n    c: [echo]\n    retries: lots\n",
+			want: []string{"test.yaml:4: cannot unmarshal !!str `lots` into int"},
+		},
+		{
+			name: "rejected by Parse",
+			yaml: "wf_file:\n  - rule: a\n    c: [echo]\n  - rule: b\n    c: [echo]\n    method: guess\n",
+			want: []string{"test.yaml:4:11: rule b: unknown method guess"},
+		},
+		{
+			name: "bad include",
+			yaml: "include: [/nosuchdir/x.yaml]\nwf_file:\n  - rule: a\n    c: [echo]\n",
+			want: []string{"test.yaml:1:10: include: open /nosuchdir/x.yaml: no such file or directory"},
+		},
+		{
+			name: "syntax",
+			yaml: "wf_file:\n  - rule: a\n   c: [echo]\n",
+			want: []string{"test.yaml:1: did not find expected '-' indicator"},
+		},
+		{
+			name: "empty",
+			yaml: "",
+			want: []string{"test.yaml:1: empty rc file"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(strings.NewReader(tt.yaml), "test.yaml")
+			got := []string{}
+			if err != nil {
+				got = strings.Split(err.Error(), "\n")
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Check() got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+
+			var checkErr *CheckError
+			if err != nil && !errors.As(err, &checkErr) {
+				t.Errorf("Check() error %v isn't a *CheckError", err)
+			}
+		})
+	}
+}
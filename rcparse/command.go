@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RetryOpts say when and how often a failing command is tried again.
+type RetryOpts struct {
+	// Retries is how many more times to try.
+	Retries int `yaml:"retries,omitempty"`
+	// RetryDelay is the wait before the first retry, doubling for each
+	// one after it.
+	RetryDelay time.Duration `yaml:"retry_delay,omitempty"`
+	// RetryOnExitCodes limits retries to these exit codes.
+	RetryOnExitCodes []int `yaml:"retry_on_exit_codes,omitempty"`
+
+	// given records which options a command set, so that setting one to
+	// its zero value still wins over its rule's.
+	given retryFields
+}
+
+type retryFields uint8
+
+const (
+	givenRetries retryFields = 1 << iota
+	givenRetryDelay
+	givenRetryOnExitCodes
+)
+
+// Over returns r, with the options it doesn't set taken from base, as a
+// command's options are from its rule's.
+func (r RetryOpts) Over(base RetryOpts) RetryOpts {
+	if r.given&givenRetries == 0 && r.Retries == 0 {
+		r.Retries = base.Retries
+	}
+	if r.given&givenRetryDelay == 0 && r.RetryDelay == 0 {
+		r.RetryDelay = base.RetryDelay
+	}
+	if r.given&givenRetryOnExitCodes == 0 && r.RetryOnExitCodes == nil {
+		r.RetryOnExitCodes = base.RetryOnExitCodes
+	}
+	return r
+}
+
+func (r RetryOpts) check() error {
+	if r.Retries < 0 {
+		return fmt.Errorf("retries can't be negative")
+	}
+	if r.RetryDelay < 0 {
+		return fmt.Errorf("retry_delay can't be negative")
+	}
+	return nil
+}
+
+// CmdOpts are the options that can be set on a single command.
+type CmdOpts struct {
+	Timeout   time.Duration `yaml:"timeout,omitempty"`
+	RetryOpts `yaml:",inline"`
+	// IgnoreError carries on with the rule when the command fails. A
+	// command starting with "-" does the same.
+	IgnoreError bool `yaml:"ignore_error,omitempty"`
+	// Script marks the rule's script block, which is run from a file
+	// rather than as a command line.
+	Script bool `yaml:"-"`
+}
+
+// Command is one entry of a rule's c: list. It is either a plain string,
+// or a mapping with the command under cmd: and its options alongside.
+type Command struct {
+	Cmd     string `yaml:"cmd"`
+	CmdOpts `yaml:",inline"`
+}
+
+func (c *Command) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*c = Command{}
+		if err := value.Decode(&c.Cmd); err != nil {
+			return err
+		}
+	} else {
+		type plain Command
+		if err := value.Decode((*plain)(c)); err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			switch value.Content[i].Value {
+			case "retries":
+				c.given |= givenRetries
+			case "retry_delay":
+				c.given |= givenRetryDelay
+			case "retry_on_exit_codes":
+				c.given |= givenRetryOnExitCodes
+			}
+		}
+	}
+
+	if rest, found := strings.CutPrefix(c.Cmd, "-"); found {
+		c.Cmd = strings.TrimLeft(rest, " \t")
+		c.IgnoreError = true
+	}
+	return nil
+}
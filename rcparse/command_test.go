@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestCommand_UnmarshalYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []Command
+		wantErr bool
+	}{
+		{
+			name: "strings",
+			yaml: "[echo a, 'echo b']",
+			want: []Command{{Cmd: "echo a"}, {Cmd: "echo b"}},
+		},
+		{
+			name: "mapping",
+			yaml: "[{cmd: sleep 1, timeout: 30s}]",
+			want: []Command{{Cmd: "sleep 1", CmdOpts: CmdOpts{Timeout: 30 * time.Second}}},
+		},
+		{
+			name: "mixed",
+			yaml: "[echo a, {cmd: echo b}]",
+			want: []Command{{Cmd: "echo a"}, {Cmd: "echo b"}},
+		},
+		{
+			name: "retries",
+			yaml: "[{cmd: go test, retries: 2, retry_delay: 1s, retry_on_exit_codes: [1, 75]}]",
+			want: []Command{{Cmd: "go test", CmdOpts: CmdOpts{RetryOpts: RetryOpts{
+				Retries: 2, RetryDelay: time.Second, RetryOnExitCodes: []int{1, 75},
+				given: givenRetries | givenRetryDelay | givenRetryOnExitCodes}}}},
+		},
+		{
+			name: "no retries",
+			yaml: "[{cmd: go test, retries: 0}]",
+			want: []Command{{Cmd: "go test", CmdOpts: CmdOpts{RetryOpts: RetryOpts{given: givenRetries}}}},
+		},
+		{
+			name: "ignore error",
+			yaml: "['-rm x', '- rm y', {cmd: rm z, ignore_error: true}, {cmd: -rm w}]",
+			want: []Command{
+				{Cmd: "rm x", CmdOpts: CmdOpts{IgnoreError: true}},
+				{Cmd: "rm y", CmdOpts: CmdOpts{IgnoreError: true}},
+				{Cmd: "rm z", CmdOpts: CmdOpts{IgnoreError: true}},
+				{Cmd: "rm w", CmdOpts: CmdOpts{IgnoreError: true}},
+			},
+		},
+		{
+			name:    "bad timeout",
+			yaml:    "[{cmd: echo, timeout: soon}]",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Command
+			err := yaml.Unmarshal([]byte(tt.yaml), &got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryOpts_Over(t *testing.T) {
+	rule := RetryOpts{Retries: 3, RetryDelay: time.Second, RetryOnExitCodes: []int{75}}
+	tests := []struct {
+		name string
+		yaml string
+		want RetryOpts
+	}{
+		{
+			name: "nothing set",
+			yaml: "{cmd: go test}",
+			want: rule,
+		},
+		{
+			name: "delay only",
+			yaml: "{cmd: go test, retry_delay: 5s}",
+			want: RetryOpts{Retries: 3, RetryDelay: 5 * time.Second, RetryOnExitCodes: []int{75}},
+		},
+		{
+			name: "codes only",
+			yaml: "{cmd: go test, retry_on_exit_codes: [1]}",
+			want: RetryOpts{Retries: 3, RetryDelay: time.Second, RetryOnExitCodes: []int{1}},
+		},
+		{
+			name: "opt out",
+			yaml: "{cmd: go test, retries: 0, retry_delay: 0s}",
+			want: RetryOpts{RetryOnExitCodes: []int{75}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Command
+			if err := yaml.Unmarshal([]byte(tt.yaml), &c); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			got := c.RetryOpts.Over(rule)
+			got.given = 0
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Over() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ParseDotenv reads KEY=VALUE lines, as found in .env files. Blank lines,
+// comments and an "export " in front are allowed. Values can be single
+// quoted, taken as is, or double quoted, with backslash escapes. Double
+// quoted and unquoted values have $VAR and ${VAR} replaced, looking first
+// at what was set earlier in the file and then using lookup.
+func ParseDotenv(r io.Reader, lookup func(string) (string, bool)) (map[string]string, error) {
+	env := map[string]string{}
+	get := func(key string) string {
+		if v, ok := env[key]; ok {
+			return v
+		}
+		if lookup != nil {
+			if v, ok := lookup(key); ok {
+				return v
+			}
+		}
+		return ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !validEnvKey(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNo)
+		}
+		value = strings.TrimLeftFunc(value, unicode.IsSpace)
+
+		start := lineNo
+		if q := firstByte(value); q == '\'' || q == '"' {
+			// quoted values can go on over several lines
+			for !closed(value[1:], q) && scanner.Scan() {
+				lineNo++
+				value += "\n" + scanner.Text()
+			}
+		}
+
+		parsed, err := dotenvValue(value, get)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		env[key] = parsed
+	}
+
+	return env, scanner.Err()
+}
+
+// LoadDotenv reads the dotenv files in order, relative to dir. Later files
+// win over earlier ones and can refer to what they set. Files that don't
+// exist are skipped.
+func LoadDotenv(dir string, files []string, lookup func(string) (string, bool)) (map[string]string, error) {
+	env := map[string]string{}
+	get := func(key string) (string, bool) {
+		if v, ok := env[key]; ok {
+			return v, true
+		}
+		if lookup != nil {
+			return lookup(key)
+		}
+		return "", false
+	}
+
+	for _, f := range files {
+		if !filepath.IsAbs(f) {
+			f = filepath.Join(dir, f)
+		}
+
+		fp, err := os.Open(f) //nolint:gosec
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		vars, err := ParseDotenv(fp, get)
+		_ = fp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+
+	return env, nil
+}
+
+func validEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		switch {
+		case r == '_', unicode.IsLetter(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[0]
+}
+
+// closed reports whether s, the part of a value after its opening quote q,
+// holds the closing quote.
+func closed(s string, q byte) bool {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && q == '"':
+			i++
+		case s[i] == q:
+			return true
+		}
+	}
+	return false
+}
+
+func dotenvValue(value string, get func(string) string) (string, error) {
+	switch firstByte(value) {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		if err := checkTrailing(value[end+2:]); err != nil {
+			return "", err
+		}
+		return value[1 : end+1], nil
+
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(value); i++ {
+			c := value[i]
+			switch c {
+			case '\\':
+				i++
+				if i == len(value) {
+					return "", fmt.Errorf("unterminated double quote")
+				}
+				b.WriteString(unescape(value[i]))
+			case '$':
+				v, n := expandVar(value[i:], get)
+				b.WriteString(v)
+				i += n - 1
+			case '"':
+				if err := checkTrailing(value[i+1:]); err != nil {
+					return "", err
+				}
+				return b.String(), nil
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quote")
+
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		value = strings.TrimSpace(value)
+
+		var b strings.Builder
+		for i := 0; i < len(value); i++ {
+			if value[i] == '$' {
+				v, n := expandVar(value[i:], get)
+				b.WriteString(v)
+				i += n - 1
+				continue
+			}
+			b.WriteByte(value[i])
+		}
+		return b.String(), nil
+	}
+}
+
+// checkTrailing allows only white space and a comment after a quoted value.
+func checkTrailing(s string) error {
+	s = strings.TrimSpace(s)
+	if s != "" && !strings.HasPrefix(s, "#") {
+		return fmt.Errorf("unexpected %q after quoted value", s)
+	}
+	return nil
+}
+
+func unescape(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	default:
+		return string(c)
+	}
+}
+
+// expandVar expands the $VAR or ${VAR} at the start of s, returning its
+// value and how much of s it took up. A $ not followed by a name is kept.
+func expandVar(s string, get func(string) string) (string, int) {
+	if strings.HasPrefix(s, "${") {
+		end := strings.IndexByte(s, '}')
+		if end < 0 || !validEnvKey(s[2:end]) {
+			return "$", 1
+		}
+		return get(s[2:end]), end + 1
+	}
+
+	n := 1
+	for n < len(s) && (s[n] == '_' || isAlnum(s[n])) {
+		n++
+	}
+	if n == 1 || isDigit(s[1]) {
+		return "$", 1
+	}
+	return get(s[1:n]), n
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	lookup := func(key string) (string, bool) {
+		if key == "OUTSIDE" {
+			return "out", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:  "plain",
+			input: "A=1\nB = two\n",
+			want:  map[string]string{"A": "1", "B": "two"},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# comment\n\nA=1 # trailing\nB=x#y\n",
+			want:  map[string]string{"A": "1", "B": "x#y"},
+		},
+		{
+			name:  "export",
+			input: "export A=1\n",
+			want:  map[string]string{"A": "1"},
+		},
+		{
+			name:  "single quotes",
+			input: `A='$B \n # not a comment'`,
+			want:  map[string]string{"A": `$B \n # not a comment`},
+		},
+		{
+			name:  "double quotes",
+			input: `A="a \"b\"\tc\n" # comment`,
+			want:  map[string]string{"A": "a \"b\"\tc\n"},
+		},
+		{
+			name:  "multi line",
+			input: "A=\"one\ntwo\"\nB=3\n",
+			want:  map[string]string{"A": "one\ntwo", "B": "3"},
+		},
+		{
+			name:  "interpolation",
+			input: "A=x\nB=${A}y\nC=\"$A-$OUTSIDE-${MISSING}\"\nD='${A}'\n",
+			want:  map[string]string{"A": "x", "B": "xy", "C": "x-out-", "D": "${A}"},
+		},
+		{
+			name:  "lone dollar",
+			input: "A=$ 5$\nB=$1\n",
+			want:  map[string]string{"A": "$ 5$", "B": "$1"},
+		},
+		{
+			name:  "empty",
+			input: "A=\nB=''\n",
+			want:  map[string]string{"A": "", "B": ""},
+		},
+		{
+			name:    "no equals",
+			input:   "A\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad key",
+			input:   "1A=2\n",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated",
+			input:   "A=\"abc\n",
+			wantErr: true,
+		},
+		{
+			name:    "junk after quote",
+			input:   "A='abc' def\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotenv(strings.NewReader(tt.input), lookup)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDotenv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !maps.Equal(got, tt.want) {
+				t.Errorf("ParseDotenv() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYRCfile_Dotenv(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		".env":       "A=dotenv\nB=dotenv\nC=dotenv\n",
+		".env.local": "B=local\n",
+		"rule.env":   "C=rule-${A}\nD=rule\n",
+		".workflow.yaml": `
+dotenv: [.env, .env.local, .env.missing]
+env:
+  A: env
+wf_file:
+  - rule: test
+    dotenv: [rule.env]
+    env:
+      D: env
+    c:
+      - echo
+  - rule: other
+    c:
+      - echo
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Unable to create %s", name)
+		}
+	}
+
+	rc, err := NewYRCFile(filepath.Join(dir, ".workflow.yaml"))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		rule string
+		want map[string]string
+	}{
+		{
+			rule: "test",
+			want: map[string]string{"A": "env", "B": "local", "C": "rule-env", "D": "env"},
+		},
+		{
+			rule: "other",
+			want: map[string]string{"A": "env", "B": "local", "C": "dotenv"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			_, env, exists := rc.GetCommandEnv(tt.rule)
+			if !exists || !maps.Equal(env, tt.want) {
+				t.Errorf("GetCommandEnv() env = %v, want %v", env, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRuleNotFound is returned for a rule the workflow file doesn't have.
+var ErrRuleNotFound = errors.New("rule not found")
+
+// errRuleTwice is returned for a rule defined twice in one document.
+var errRuleTwice = errors.New("defined twice")
+
+// ruleError is a problem with the definition of rule, so Check can point
+// at it.
+type ruleError struct {
+	rule string
+	err  error
+}
+
+func (e *ruleError) Error() string {
+	return fmt.Sprintf("rule %s: %v", e.rule, e.err)
+}
+
+func (e *ruleError) Unwrap() error {
+	return e.err
+}
+
+// includeError is a problem with an include, including those of the
+// rules in the included file.
+type includeError struct {
+	err error
+}
+
+func (e *includeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *includeError) Unwrap() error {
+	return e.err
+}
+
+// TemplateError is a command template of Rule that couldn't be parsed or
+// executed. Line is the position of the command in the rule, from 1.
+type TemplateError struct {
+	Rule string
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("rule %s: template of command %d: %v", e.Rule, e.Line, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// CheckError is a problem Check found in a workflow file, at Line and Col
+// of File. Col is 0 when only the line is known.
+type CheckError struct {
+	File string
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *CheckError) Error() string {
+	if e.Col == 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
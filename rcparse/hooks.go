@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// The hooks of a rule, or of the top level of a workflow file.
+const (
+	// HookBefore runs before the commands.
+	HookBefore = "before"
+	// HookAfter runs after the commands, if they all succeeded.
+	HookAfter = "after"
+	// HookOnFailure runs if something failed.
+	HookOnFailure = "on_failure"
+	// HookFinally runs last, no matter what.
+	HookFinally = "finally"
+)
+
+// Hooks are command lists run around the commands of a rule, or around
+// everything wf runs.
+type Hooks struct {
+	Before    []Command `yaml:"before,omitempty"`
+	After     []Command `yaml:"after,omitempty"`
+	OnFailure []Command `yaml:"on_failure,omitempty"`
+	Finally   []Command `yaml:"finally,omitempty"`
+}
+
+// Get returns the commands of hook.
+func (h Hooks) Get(hook string) ([]Command, error) {
+	switch hook {
+	case HookBefore:
+		return h.Before, nil
+	case HookAfter:
+		return h.After, nil
+	case HookOnFailure:
+		return h.OnFailure, nil
+	case HookFinally:
+		return h.Finally, nil
+	}
+	return nil, fmt.Errorf("unknown hook %s", hook)
+}
+
+func (h Hooks) merge(more Hooks) Hooks {
+	return Hooks{
+		Before:    append(h.Before, more.Before...),
+		After:     append(h.After, more.After...),
+		OnFailure: append(h.OnFailure, more.OnFailure...),
+		Finally:   append(h.Finally, more.Finally...),
+	}
+}
+
+// HookStatus is what hooks are told about the run they follow. Their
+// templates get it as .Failed and .ExitCode, and their environment as
+// WF_FAILED_RULE and WF_EXIT_CODE.
+type HookStatus struct {
+	// Failed is the rule that failed, if one did, or the name of the top
+	// level hook that failed.
+	Failed string
+	// ExitCode is the exit code of the failure.
+	ExitCode int
+}
+
+// HookCommandEnv returns the commands of hook of rule, or of the top
+// level when rule is "", with their templates executed against status.
+// They come with the rest of the rule's settings, or the top level
+// defaults, and the environment to run them with.
+func (rc *YRCfile) HookCommandEnv(rule string, hook string, status HookStatus) (CmdEnv, map[string]string, error) {
+	val := CmdEnv{EnvMode: EnvInherit, Shell: rc.Shell, Dir: rc.Dir}
+	hooks := rc.Hooks
+	data := tmplData{G: rc.G, V: rc.V, Args: []string{}, Failed: status.Failed, ExitCode: status.ExitCode}
+	name := "(top level)"
+
+	if rule != "" {
+		var exists bool
+		val, exists = rc.GetRule(rule)
+		if !exists {
+			return CmdEnv{}, nil, fmt.Errorf("%w: %s", ErrRuleNotFound, rule)
+		}
+		params, err := rc.ruleParams(rule, val)
+		if err != nil {
+			return CmdEnv{}, nil, err
+		}
+		hooks = val.Hooks
+		vars := rc.tmplData(val)
+		data.G, data.V = vars.G, vars.V
+		data.Args, data.P = rc.GetArgs(rule), params
+		name = rule
+	}
+
+	cmds, err := hooks.Get(hook)
+	if err != nil {
+		return CmdEnv{}, nil, err
+	}
+	val.Cmd, val.Opts = []string{}, []CmdOpts{}
+	raw := []string{}
+	for _, c := range cmds {
+		raw = append(raw, c.Cmd)
+		val.Opts = append(val.Opts, c.CmdOpts)
+	}
+	if val.Cmd, err = expandCommands(name, raw, data); err != nil {
+		return CmdEnv{}, nil, fmt.Errorf("%s hook: %w", hook, err)
+	}
+
+	env, err := rc.ruleEnv(val)
+	if err != nil {
+		return CmdEnv{}, nil, fmt.Errorf("rule %s: %w", name, err)
+	}
+	env["WF_FAILED_RULE"] = status.Failed
+	env["WF_EXIT_CODE"] = strconv.Itoa(status.ExitCode)
+	return val, env, nil
+}
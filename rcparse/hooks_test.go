@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+const HooksFile = `
+vars:
+  x: top
+before:
+  - echo top {{.V.x}}
+on_failure:
+  - echo {{.Failed}} failed with {{.ExitCode}}
+wf_file:
+  - rule: a
+    env:
+      A: "1"
+    finally:
+      - echo a {{.Failed}}
+      - "-rm tmp"
+    c:
+      - "true"
+`
+
+func TestYRCfile_HookCommandEnv(t *testing.T) {
+	rc, err := CreateYRCFile(bytes.NewBufferString(HooksFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		hook    string
+		status  HookStatus
+		wantCmd []string
+		wantEnv map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "top level",
+			hook:    HookBefore,
+			wantCmd: []string{"echo top top"},
+			wantEnv: map[string]string{"WF_FAILED_RULE": "", "WF_EXIT_CODE": "0"},
+		},
+		{
+			name:    "top level status",
+			hook:    HookOnFailure,
+			status:  HookStatus{Failed: "a", ExitCode: 3},
+			wantCmd: []string{"echo a failed with 3"},
+			wantEnv: map[string]string{"WF_FAILED_RULE": "a", "WF_EXIT_CODE": "3"},
+		},
+		{
+			name:    "rule",
+			rule:    "a",
+			hook:    HookFinally,
+			status:  HookStatus{Failed: "a", ExitCode: 1},
+			wantCmd: []string{"echo a a", "rm tmp"},
+			wantEnv: map[string]string{"A": "1", "WF_FAILED_RULE": "a", "WF_EXIT_CODE": "1"},
+		},
+		{
+			name:    "rule without the hook",
+			rule:    "a",
+			hook:    HookBefore,
+			wantCmd: []string{},
+		},
+		{
+			name:    "unknown hook",
+			rule:    "a",
+			hook:    "sometimes",
+			wantErr: true,
+		},
+		{
+			name:    "unknown rule",
+			rule:    "b",
+			hook:    HookBefore,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, env, err := rc.HookCommandEnv(tt.rule, tt.hook, tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HookCommandEnv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !slices.Equal(r.Cmd, tt.wantCmd) {
+				t.Errorf("HookCommandEnv() got = %q, want %q", r.Cmd, tt.wantCmd)
+			}
+			for k, v := range tt.wantEnv {
+				if env[k] != v {
+					t.Errorf("HookCommandEnv() env[%s] = %q, want %q", k, env[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Include is another workflow file whose rules are pulled in, with their
+// names prefixed by Namespace and a colon, if it is set.
+type Include struct {
+	Namespace string
+	File      string
+}
+
+// Includes is the include: key of a workflow file. It is either a list of
+// files, or a mapping of namespaces to files.
+type Includes []Include
+
+func (inc *Includes) UnmarshalYAML(value *yaml.Node) error {
+	*inc = nil
+	switch value.Kind {
+	case yaml.SequenceNode:
+		var files []string
+		if err := value.Decode(&files); err != nil {
+			return err
+		}
+		for _, f := range files {
+			*inc = append(*inc, Include{File: f})
+		}
+		return nil
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(value.Content); i += 2 {
+			var in Include
+			if err := value.Content[i].Decode(&in.Namespace); err != nil {
+				return err
+			}
+			if err := value.Content[i+1].Decode(&in.File); err != nil {
+				return err
+			}
+			if in.Namespace == "" || strings.Contains(in.Namespace, ":") {
+				return fmt.Errorf("line %d: bad include namespace %q", value.Content[i].Line, in.Namespace)
+			}
+			*inc = append(*inc, in)
+		}
+		return nil
+	}
+	return fmt.Errorf("line %d: include must be a list or a mapping", value.Line)
+}
+
+// include reads the workflow file of inc, relative to rc's, and adds its
+// rules to rc.
+func (rc *YRCfile) include(inc Include) error {
+	file := inc.File
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(rc.Dir, file)
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(rc.including, file) {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(rc.including, file), " -> "))
+	}
+
+	fp, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("include: %w", err)
+	}
+	defer func() {
+		_ = fp.Close()
+	}()
+
+	child := newYRCfile()
+	child.Dir = filepath.Dir(file)
+	child.File = file
+	child.including = append(slices.Clip(rc.including), file)
+	if err := child.Parse(fp); err != nil {
+		return fmt.Errorf("include %s: %w", inc.File, err)
+	}
+
+	rc.merge(child, inc.Namespace)
+	return nil
+}
+
+// merge adds the rules of child to rc, prefixed by ns. The top level env,
+// dotenv files and shell of child go along with its rules. With a
+// namespace, so do its vars and globals; without, they are added to rc's.
+// Top level hooks of child are not used.
+func (rc *YRCfile) merge(child *YRCfile, ns string) {
+	name := func(rule string) string {
+		if ns == "" {
+			return rule
+		}
+		return ns + ":" + rule
+	}
+
+	for rule, val := range child.Commands {
+		deps := make([]string, 0, len(val.Deps))
+		for _, d := range val.Deps {
+			if _, ok := child.Commands[d]; ok {
+				d = name(d)
+			}
+			deps = append(deps, d)
+		}
+		val.Deps = deps
+
+		envs := make(map[string]string, len(child.Env)+len(val.Envs))
+		for k, v := range child.Env {
+			envs[k] = v
+		}
+		for k, v := range val.Envs {
+			envs[k] = v
+		}
+		val.Envs = envs
+		val.Dotenv = append(slices.Clip(child.Dotenv), val.Dotenv...)
+		if val.Shell == "" {
+			val.Shell = child.Shell
+		}
+		if ns != "" && val.V == nil {
+			val.G, val.V = child.G, child.V
+		}
+
+		rc.Commands[name(rule)] = val
+	}
+
+	if ns != "" {
+		return
+	}
+	for k, v := range child.G {
+		rc.G[k] = v
+	}
+	for k, v := range child.V {
+		rc.V[k] = v
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestYRCfile_Include(t *testing.T) {
+	shared := "vars: {lint: golangci-lint, pkg: ./lib/...}\nenv: {CGO_ENABLED: \"0\"}\nwf_file:\n" +
+		"  - rule: lint\n    c: ['{{.V.lint}} run {{.V.pkg}}']\n" +
+		"  - rule: test\n    deps: [lint, generate]\n    c: [go test]\n"
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		rule     string
+		wantCmd  []string
+		wantDeps []string
+		wantEnv  map[string]string
+		wantErr  string
+	}{
+		{
+			name: "list",
+			files: map[string]string{
+				".workflow.yaml": "include: [shared/rules.yaml]\nvars: {pkg: ./...}\n" +
+					"wf_file:\n  - rule: generate\n    c: [go generate]\n",
+				"shared/rules.yaml": shared,
+			},
+			rule:     "lint",
+			wantCmd:  []string{"golangci-lint run ./..."},
+			wantDeps: []string{},
+			wantEnv:  map[string]string{"CGO_ENABLED": "0"},
+		},
+		{
+			name: "own rule wins",
+			files: map[string]string{
+				".workflow.yaml":    "include: [shared/rules.yaml]\nwf_file:\n  - rule: lint\n    c: [go vet]\n",
+				"shared/rules.yaml": shared,
+			},
+			rule:     "lint",
+			wantCmd:  []string{"go vet"},
+			wantDeps: []string{},
+			wantEnv:  map[string]string{},
+		},
+		{
+			name: "namespace",
+			files: map[string]string{
+				".workflow.yaml": "include: {ci: shared/rules.yaml}\n" +
+					"wf_file:\n  - rule: generate\n    c: [go generate]\n",
+				"shared/rules.yaml": shared,
+			},
+			rule:     "ci:test",
+			wantCmd:  []string{"go test"},
+			wantDeps: []string{"ci:lint", "generate"},
+			wantEnv:  map[string]string{"CGO_ENABLED": "0"},
+		},
+		{
+			name: "nested",
+			files: map[string]string{
+				".workflow.yaml": "include: {ci: ci/ci.yaml}\nwf_file: []\n",
+				"ci/ci.yaml":     "include: {go: go.yaml}\nwf_file: []\n",
+				"ci/go.yaml":     "wf_file:\n  - rule: build\n    c: [go build]\n  - rule: all\n    deps: [build]\n    c: [echo]\n",
+			},
+			rule:     "ci:go:all",
+			wantCmd:  []string{"echo"},
+			wantDeps: []string{"ci:go:build"},
+			wantEnv:  map[string]string{},
+		},
+		{
+			name: "namespace keeps its vars",
+			files: map[string]string{
+				".workflow.yaml":    "include: {ci: shared/rules.yaml, other: other.yaml}\nvars: {pkg: ./...}\nwf_file: []\n",
+				"shared/rules.yaml": shared,
+				"other.yaml":        "vars: {lint: revive}\nwf_file:\n  - rule: lint\n    c: ['{{.V.lint}}']\n",
+			},
+			rule:     "ci:lint",
+			wantCmd:  []string{"golangci-lint run ./lib/..."},
+			wantDeps: []string{},
+			wantEnv:  map[string]string{},
+		},
+		{
+			name: "dotenv of the included file",
+			files: map[string]string{
+				".workflow.yaml": "include: {ci: shared/rules.yaml}\nwf_file: []\n",
+				"shared/rules.yaml": "dotenv: [ci.env]\nwf_file:\n  - rule: env\n    dotenv: [rule.env]\n" +
+					"    c: [env]\n",
+				"shared/ci.env":   "A=1\n",
+				"shared/rule.env": "B=2\n",
+			},
+			rule:     "ci:env",
+			wantCmd:  []string{"env"},
+			wantDeps: []string{},
+			wantEnv:  map[string]string{"A": "1", "B": "2"},
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				".workflow.yaml": "include: [a.yaml]\nwf_file: []\n",
+				"a.yaml":         "include: [b/b.yaml]\nwf_file: []\n",
+				"b/b.yaml":       "include: [../a.yaml]\nwf_file: []\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "self",
+			files: map[string]string{
+				".workflow.yaml": "include: [.workflow.yaml]\nwf_file: []\n",
+			},
+			wantErr: "include cycle",
+		},
+		{
+			name: "missing",
+			files: map[string]string{
+				".workflow.yaml": "include: [nothere.yaml]\nwf_file: []\n",
+			},
+			wantErr: "nothere.yaml",
+		},
+		{
+			name: "bad namespace",
+			files: map[string]string{
+				".workflow.yaml": "include: {\"a:b\": a.yaml}\nwf_file: []\n",
+			},
+			wantErr: "bad include namespace",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rc, err := NewYRCFile(filepath.Join(dir, ".workflow.yaml"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("NewYRCFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewYRCFile() error = %v", err)
+			}
+
+			cmd, env, err := rc.CommandEnv(tt.rule)
+			if err != nil {
+				t.Fatalf("CommandEnv() error = %v", err)
+			}
+			if !slices.Equal(cmd, tt.wantCmd) {
+				t.Errorf("CommandEnv() got = %q, want %q", cmd, tt.wantCmd)
+			}
+			if deps, _ := rc.GetDeps(tt.rule); !slices.Equal(deps, tt.wantDeps) {
+				t.Errorf("GetDeps() got = %q, want %q", deps, tt.wantDeps)
+			}
+			for k, v := range tt.wantEnv {
+				if env[k] != v {
+					t.Errorf("CommandEnv() env[%s] = %q, want %q", k, env[k], v)
+				}
+			}
+			if r, _ := rc.GetRule(tt.rule); r.Dir != dir {
+				t.Errorf("GetRule() dir = %s, want %s", r.Dir, dir)
+			}
+		})
+	}
+}
+
+func TestYRCfile_IncludeRelative(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "wf.yaml"), []byte("include: [wf.yaml]\nwf_file: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldPwd, _ := os.Getwd()
+	defer func() {
+		_ = os.Chdir(oldPwd)
+	}()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewYRCFile("wf.yaml"); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("NewYRCFile() error = %v, want an include cycle", err)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Param describes a named parameter of a rule. Parameters are given on
+// the command line as name=value, --name=value or --name value, and are
+// available to the rule's templates as .P.name.
+type Param struct {
+	Name     string   `yaml:"name"`
+	Type     string   `yaml:"type,omitempty"`
+	Default  string   `yaml:"default,omitempty"`
+	Required bool     `yaml:"required,omitempty"`
+	Help     string   `yaml:"help,omitempty"`
+	Values   []string `yaml:"values,omitempty"`
+}
+
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamEnum   = "enum"
+)
+
+// check makes sure the parameter description itself makes sense.
+func (p *Param) check() error {
+	if p.Name == "" {
+		return fmt.Errorf("parameter without a name")
+	}
+	switch p.Type {
+	case "":
+		p.Type = ParamString
+	case ParamString, ParamInt, ParamBool:
+	case ParamEnum:
+		if len(p.Values) == 0 {
+			return fmt.Errorf("enum parameter %s has no values", p.Name)
+		}
+	default:
+		return fmt.Errorf("parameter %s has unknown type %s", p.Name, p.Type)
+	}
+
+	if p.Default != "" {
+		if _, err := p.convert(p.Default); err != nil {
+			return fmt.Errorf("bad default: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkParams checks each of params, and that no two share a name.
+func checkParams(params []Param) error {
+	seen := map[string]bool{}
+	for i := range params {
+		if err := params[i].check(); err != nil {
+			return err
+		}
+		if seen[params[i].Name] {
+			return fmt.Errorf("parameter %s given twice", params[i].Name)
+		}
+		seen[params[i].Name] = true
+	}
+	return nil
+}
+
+// convert turns value into the parameter's type.
+func (p *Param) convert(value string) (any, error) {
+	switch p.Type {
+	case ParamInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s wants an int, got %q", p.Name, value)
+		}
+		return i, nil
+	case ParamBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s wants a bool, got %q", p.Name, value)
+		}
+		return b, nil
+	case ParamEnum:
+		if !slices.Contains(p.Values, value) {
+			return nil, fmt.Errorf("parameter %s must be one of %s, got %q",
+				p.Name, strings.Join(p.Values, "|"), value)
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// Usage is a one line description of the parameter.
+func (p *Param) Usage() string {
+	kind := p.Type
+	if p.Type == ParamEnum {
+		kind = strings.Join(p.Values, "|")
+	}
+
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b, "%s=<%s>", p.Name, kind)
+	if p.Required {
+		b.WriteString(" (required)")
+	} else if p.Default != "" {
+		_, _ = fmt.Fprintf(&b, " (default %s)", p.Default)
+	}
+	if p.Help != "" {
+		b.WriteString("  ")
+		b.WriteString(p.Help)
+	}
+	return b.String()
+}
+
+// bindParams picks the values of params out of args. Whatever isn't a
+// parameter is returned, in order, as the remaining arguments. A "--"
+// stops the search for parameters.
+func bindParams(params []Param, args []string) (map[string]any, []string, error) {
+	values := map[string]any{}
+	rest := []string{}
+
+	find := func(name string) *Param {
+		for i := range params {
+			if params[i].Name == name {
+				return &params[i]
+			}
+		}
+		return nil
+	}
+	set := func(p *Param, value string) error {
+		v, err := p.convert(value)
+		if err != nil {
+			return err
+		}
+		values[p.Name] = v
+		return nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			rest = append(rest, args[i+1:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		p := find(name)
+		if p == nil || (!hasValue && !strings.HasPrefix(arg, "--")) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		switch {
+		case hasValue:
+		case p.Type == ParamBool:
+			value = "true"
+		case i+1 < len(args):
+			i++
+			value = args[i]
+		default:
+			return nil, nil, fmt.Errorf("parameter %s needs a value", p.Name)
+		}
+
+		if err := set(p, value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for i := range params {
+		p := &params[i]
+		if _, ok := values[p.Name]; ok {
+			continue
+		}
+		if p.Required {
+			return nil, nil, fmt.Errorf("missing required parameter %s", p.Usage())
+		}
+		if p.Default != "" {
+			if err := set(p, p.Default); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		values[p.Name] = zeroValues[p.Type]
+	}
+
+	return values, rest, nil
+}
+
+// zeroValues are the values of parameters that are neither given nor have
+// a default.
+var zeroValues = map[string]any{
+	ParamString: "",
+	ParamInt:    0,
+	ParamBool:   false,
+	ParamEnum:   "",
+}
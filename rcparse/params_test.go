@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var testParams = []Param{
+	{Name: "env", Type: ParamEnum, Values: []string{"staging", "prod"}, Required: true},
+	{Name: "replicas", Type: ParamInt, Default: "1"},
+	{Name: "dry", Type: ParamBool},
+	{Name: "tag", Type: ParamString},
+}
+
+func Test_bindParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		want     map[string]any
+		wantRest []string
+		wantErr  bool
+	}{
+		{
+			name:     "name=value",
+			args:     []string{"env=staging", "replicas=3"},
+			want:     map[string]any{"env": "staging", "replicas": 3, "dry": false, "tag": ""},
+			wantRest: []string{},
+		},
+		{
+			name:     "flags",
+			args:     []string{"--env", "prod", "--dry", "--tag=v1.2"},
+			want:     map[string]any{"env": "prod", "replicas": 1, "dry": true, "tag": "v1.2"},
+			wantRest: []string{},
+		},
+		{
+			name:     "other args kept",
+			args:     []string{"-v", "env=prod", "extra", "other=1"},
+			want:     map[string]any{"env": "prod", "replicas": 1, "dry": false, "tag": ""},
+			wantRest: []string{"-v", "extra", "other=1"},
+		},
+		{
+			name:     "separator",
+			args:     []string{"env=prod", "--", "replicas=2"},
+			want:     map[string]any{"env": "prod", "replicas": 1, "dry": false, "tag": ""},
+			wantRest: []string{"replicas=2"},
+		},
+		{
+			name:     "explicit bool",
+			args:     []string{"env=prod", "--dry=false"},
+			want:     map[string]any{"env": "prod", "replicas": 1, "dry": false, "tag": ""},
+			wantRest: []string{},
+		},
+		{
+			name:    "missing required",
+			args:    []string{"replicas=2"},
+			wantErr: true,
+		},
+		{
+			name:    "bad enum",
+			args:    []string{"env=dev"},
+			wantErr: true,
+		},
+		{
+			name:    "bad int",
+			args:    []string{"env=prod", "replicas=many"},
+			wantErr: true,
+		},
+		{
+			name:    "missing value",
+			args:    []string{"env=prod", "--tag"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rest, err := bindParams(testParams, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("bindParams() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bindParams() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(rest, tt.wantRest) {
+				t.Errorf("bindParams() rest = %v, want %v", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestParam_check(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   Param
+		wantErr bool
+	}{
+		{
+			name:  "default type",
+			param: Param{Name: "a"},
+		},
+		{
+			name:  "good default",
+			param: Param{Name: "a", Type: ParamInt, Default: "4"},
+		},
+		{
+			name:    "bad default",
+			param:   Param{Name: "a", Type: ParamBool, Default: "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "no name",
+			param:   Param{Type: ParamInt},
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			param:   Param{Name: "a", Type: "float"},
+			wantErr: true,
+		},
+		{
+			name:    "enum without values",
+			param:   Param{Name: "a", Type: ParamEnum},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.param.check(); (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_checkParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []Param
+		wantErr bool
+	}{
+		{
+			name:   "none",
+			params: nil,
+		},
+		{
+			name:   "different names",
+			params: []Param{{Name: "a"}, {Name: "b", Type: ParamInt}},
+		},
+		{
+			name:    "same name",
+			params:  []Param{{Name: "a"}, {Name: "b"}, {Name: "a", Type: ParamInt}},
+			wantErr: true,
+		},
+		{
+			name:    "bad param",
+			params:  []Param{{Name: "a"}, {Name: "b", Type: "float"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkParams(tt.params); (err != nil) != tt.wantErr {
+				t.Errorf("checkParams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+const ParamsFile = `
+wf_file:
+  - rule: deploy
+    params:
+      - name: env
+        type: enum
+        values: [staging, prod]
+        required: true
+        help: where to deploy
+      - name: replicas
+        type: int
+        default: 2
+    c:
+      - deploy --env {{.P.env}} --replicas {{.P.replicas}} {{join " " .Args}}
+`
+
+func TestYRCfile_SetArgsParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "params",
+			args: []string{"env=staging", "replicas=3"},
+			want: "deploy --env staging --replicas 3 ",
+		},
+		{
+			name: "defaults and args",
+			args: []string{"--env", "prod", "-v"},
+			want: "deploy --env prod --replicas 2 -v",
+		},
+		{
+			name:    "invalid",
+			args:    []string{"env=qa"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(bytes.NewBufferString(ParamsFile))
+			if err != nil {
+				t.Fatalf("Unable to parse test rcfile: %v", err)
+			}
+			err = rc.SetArgs("deploy", tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			cmd, exists := rc.GetCommand("deploy")
+			if !exists || cmd[0] != tt.want {
+				t.Errorf("GetCommand() got = %q, want %q", cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseBadParam(t *testing.T) {
+	_, err := CreateYRCFile(bytes.NewBufferString(`
+wf_file:
+  - rule: deploy
+    params:
+      - name: replicas
+        type: int
+        default: lots
+    c:
+      - deploy
+`))
+	if err == nil {
+		t.Errorf("Parse() accepted a bad default")
+	}
+}
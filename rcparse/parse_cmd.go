@@ -13,126 +13,337 @@ package rcparse
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-const (
-	Start = iota
-	InDoubleq
-	InSingleq
-	InWord
-	InSpace
-)
+// WordOpts are the expansions done when splitting a command into words.
+type WordOpts struct {
+	// Lookup finds the value of a variable for $VAR and ${VAR:-default}.
+	// Without it a $ is just a $.
+	Lookup func(string) (string, bool)
+	// Tilde expands a ~ starting an unquoted word to the home directory.
+	Tilde bool
+	// Glob expands unquoted words with *, ? or [ in them to the files
+	// they match. A word matching nothing is kept as it is.
+	Glob bool
+}
+
+// SyntaxError is a mistake in a command line, found at byte Pos of Cmd.
+type SyntaxError struct {
+	Cmd string
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at %d in %v", e.Msg, e.Pos, e.Cmd)
+}
 
+// ParseCmd splits cmd into a command and its arguments, the way a POSIX
+// shell splits a simple command into words, without any expansions.
 func ParseCmd(cmd string) (string, []string, error) {
-	outslice := []string{}
-	lastSlice := []rune{}
-	cmd = strings.Trim(cmd, " \t\n")
-	rcmd := []rune(cmd)
-	state := Start
-
-	for i, r := range rcmd {
-
-		switch state {
-		case Start:
-			{
-				switch {
-				case unicode.IsSpace(r):
-					state = InSpace
-				case r == '"':
-					state = InDoubleq
-				case r == '\'':
-					state = InSingleq
-				case unicode.IsPrint(r):
-					{
-						// this would include a space char, but we have covered that
-						state = InWord
-						lastSlice = append(lastSlice, r)
-					}
-				default:
-					return "", nil, fmt.Errorf("parsing Error at %d in %v", i, cmd)
-				}
+	return ParseCmdWith(cmd, WordOpts{})
+}
 
+// ParseCmdWith is ParseCmd, doing the expansions in opts.
+func ParseCmdWith(cmd string, opts WordOpts) (string, []string, error) {
+	words, err := SplitWords(cmd, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(words) == 0 {
+		return "", nil, &SyntaxError{Cmd: cmd, Pos: 0, Msg: "empty command"}
+	}
+	return words[0], words[1:], nil
+}
+
+// SplitWords splits s into words like a POSIX shell does. Words are
+// separated by unquoted white space. A backslash keeps the next character
+// as it is, and a backslash before a newline is dropped. Single quotes
+// keep everything up to the next single quote; double quotes do the same
+// but allow \$, \`, \", \\ and variables. Quoted and unquoted parts
+// next to each other make up a single word, and "" is an empty word.
+//
+// The value of a variable is never split into further words.
+func SplitWords(s string, opts WordOpts) ([]string, error) {
+	w := wordSplitter{s: s, opts: opts, words: []string{}}
+	return w.split()
+}
+
+type wordSplitter struct {
+	s    string
+	opts WordOpts
+
+	words []string
+	// word is the word so far, and pattern the same with everything
+	// quoted escaped, for globbing it.
+	word    strings.Builder
+	pattern strings.Builder
+	inWord  bool
+	isGlob  bool
+	// start is where the word began.
+	start int
+}
+
+func (w *wordSplitter) fail(pos int, msg string) error {
+	return &SyntaxError{Cmd: w.s, Pos: pos, Msg: msg}
+}
+
+func (w *wordSplitter) split() ([]string, error) {
+	s := w.s
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !w.inWord {
+			w.start = i
+		}
+		switch {
+		case unicode.IsSpace(r):
+			if err := w.endWord(); err != nil {
+				return nil, err
 			}
-		case InDoubleq:
-			{
-				switch {
-				case r == '"':
-					{
-						outslice = append(outslice, string(lastSlice))
-						// maybe copy this?
-						lastSlice = []rune{}
-						state = Start
-					}
-				case unicode.IsPrint(r):
-					lastSlice = append(lastSlice, r)
-				default:
-					return "", nil, fmt.Errorf("parsing Error at %d in %v", i, cmd)
-				}
+			i += size
+
+		case r == '\\':
+			if i+1 == len(s) {
+				return nil, w.fail(i, "trailing backslash")
 			}
-		case InSingleq:
-			{
-				switch {
-				case r == '\'':
-					{
-						outslice = append(outslice, string(lastSlice))
-						// maybe copy this?
-						lastSlice = []rune{}
-						state = Start
-					}
-				case unicode.IsPrint(r):
-					lastSlice = append(lastSlice, r)
-				default:
-					return "", nil, fmt.Errorf("parsing Error at %d in %v", i, cmd)
-				}
+			r, size = utf8.DecodeRuneInString(s[i+1:])
+			if r != '\n' {
+				w.quoted(string(r))
+			}
+			i += 1 + size
 
+		case r == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, w.fail(i, "unterminated single quote")
 			}
-		case InWord:
-			{
-				switch {
-				case unicode.IsSpace(r):
-					{
-						outslice = append(outslice, string(lastSlice))
-						// maybe copy this?
-						lastSlice = []rune{}
-						state = InSpace
-
-					}
-				case unicode.IsPrint(r):
-					// don't embed a single or double quote in a word
-					lastSlice = append(lastSlice, r)
-				default:
-					return "", nil, fmt.Errorf("parsing Error at %d in %v", i, cmd)
-				}
+			w.quoted(s[i+1 : i+1+end])
+			i += end + 2
+
+		case r == '"':
+			n, err := w.doubleQuoted(i)
+			if err != nil {
+				return nil, err
 			}
-		case InSpace:
-			{
-				switch {
-				case unicode.IsSpace(r):
-					state = InSpace
-				case r == '"':
-					state = InDoubleq
-				case r == '\'':
-					state = InSingleq
-				case unicode.IsPrint(r):
-					{
-						lastSlice = append(lastSlice, r)
-						state = InWord
-					}
-				default:
-					return "", nil, fmt.Errorf("parsing Error at %d in %v", i, cmd)
+			i += n
 
-				}
+		case r == '$' && w.opts.Lookup != nil:
+			v, n, err := w.variable(i)
+			if err != nil {
+				return nil, err
+			}
+			w.quoted(v)
+			i += n
+
+		case r == '~' && !w.inWord && w.opts.Tilde && tildeEnds(s[i+1:]):
+			w.quoted(w.home())
+			i += size
+
+		case !unicode.IsPrint(r):
+			return nil, w.fail(i, "unexpected character")
+
+		default:
+			w.literal(s[i : i+size])
+			i += size
+		}
+	}
+	if err := w.endWord(); err != nil {
+		return nil, err
+	}
+	return w.words, nil
+}
 
+// doubleQuoted takes the double quoted part starting at i, returning how
+// much of the command it took up.
+func (w *wordSplitter) doubleQuoted(start int) (int, error) {
+	s := w.s
+	w.quoted("")
+	for i := start + 1; i < len(s); {
+		switch s[i] {
+		case '"':
+			return i + 1 - start, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+				if s[i+1] != '\n' {
+					w.quoted(s[i+1 : i+2])
+				}
+				i += 2
+				continue
 			}
+		case '$':
+			if w.opts.Lookup != nil {
+				v, n, err := w.variable(i)
+				if err != nil {
+					return 0, err
+				}
+				w.quoted(v)
+				i += n
+				continue
+			}
+		}
+		w.quoted(s[i : i+1])
+		i++
+	}
+	return 0, w.fail(start, "unterminated double quote")
+}
+
+// variable expands the $VAR, ${VAR}, ${VAR:-default} or ${VAR-default}
+// at i. With :- the default is used when VAR is unset or empty, with -
+// only when it is unset. A $ not followed by a name is kept.
+func (w *wordSplitter) variable(i int) (string, int, error) {
+	s := w.s[i:]
+	if !strings.HasPrefix(s, "${") {
+		n := 1
+		for n < len(s) && (s[n] == '_' || isAlnum(s[n])) {
+			n++
+		}
+		if n == 1 || isDigit(s[1]) {
+			return "$", 1, nil
 		}
+		v, _ := w.opts.Lookup(s[1:n])
+		return v, n, nil
+	}
 
+	end, depth := -1, 0
+	for j := 2; j < len(s) && end < 0; j++ {
+		switch {
+		case strings.HasPrefix(s[j:], "${"):
+			depth++
+			j++
+		case s[j] == '}' && depth > 0:
+			depth--
+		case s[j] == '}':
+			end = j
+		}
+	}
+	if end < 0 {
+		return "", 0, w.fail(i, "unterminated ${")
 	}
 
-	if len(lastSlice) != 0 {
-		outslice = append(outslice, string(lastSlice))
+	name, hasDef, unsetOnly := s[2:end], false, false
+	defStart := 0
+	if k := strings.IndexByte(name, '-'); k >= 0 {
+		name, hasDef, defStart = name[:k], true, i+2+k+1
+		if strings.HasSuffix(name, ":") {
+			name = name[:len(name)-1]
+		} else {
+			unsetOnly = true
+		}
+	}
+	if !validName(name) {
+		return "", 0, w.fail(i, "bad substitution")
+	}
+
+	v, set := w.opts.Lookup(name)
+	if hasDef && (!set || (!unsetOnly && v == "")) {
+		var err error
+		v, err = w.expandDefault(defStart, i+end)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	return v, end + 1, nil
+}
+
+// expandDefault expands the variables in the default of a ${VAR:-default},
+// found between start and end.
+func (w *wordSplitter) expandDefault(start, end int) (string, error) {
+	var b strings.Builder
+	for j := start; j < end; j++ {
+		if w.s[j] != '$' {
+			b.WriteByte(w.s[j])
+			continue
+		}
+		v, n, err := w.variable(j)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+		j += n - 1
+	}
+	return b.String(), nil
+}
+
+// validName reports whether name can be a shell variable.
+func validName(name string) bool {
+	if name == "" || isDigit(name[0]) {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] != '_' && !isAlnum(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// tildeEnds reports whether a ~ followed by s stands for the home
+// directory on its own.
+func tildeEnds(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return s == "" || r == '/' || unicode.IsSpace(r)
+}
+
+func (w *wordSplitter) home() string {
+	if w.opts.Lookup != nil {
+		if h, ok := w.opts.Lookup("HOME"); ok && h != "" {
+			return h
+		}
+	}
+	if h, err := os.UserHomeDir(); err == nil {
+		return h
+	}
+	return "~"
+}
+
+// literal adds unquoted text to the word.
+func (w *wordSplitter) literal(t string) {
+	w.inWord = true
+	w.word.WriteString(t)
+	w.pattern.WriteString(t)
+	if strings.ContainsAny(t, "*?[") {
+		w.isGlob = true
+	}
+}
+
+// quoted adds text to the word that is taken as is.
+func (w *wordSplitter) quoted(t string) {
+	w.inWord = true
+	w.word.WriteString(t)
+	for _, r := range t {
+		if strings.ContainsRune(`*?[]\`, r) {
+			w.pattern.WriteByte('\\')
+		}
+		w.pattern.WriteRune(r)
+	}
+}
+
+func (w *wordSplitter) endWord() error {
+	if !w.inWord {
+		return nil
+	}
+
+	matches := []string(nil)
+	if w.isGlob && w.opts.Glob {
+		var err error
+		matches, err = filepath.Glob(w.pattern.String())
+		if err != nil {
+			return w.fail(w.start, "bad pattern")
+		}
+	}
+	if len(matches) > 0 {
+		w.words = append(w.words, matches...)
+	} else {
+		w.words = append(w.words, w.word.String())
 	}
 
-	return outslice[0], outslice[1:], nil
+	w.word.Reset()
+	w.pattern.Reset()
+	w.inWord, w.isGlob = false, false
+	return nil
 }
@@ -12,6 +12,9 @@
 package rcparse
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -34,9 +37,7 @@ func TestParseCmd(t *testing.T) {
 		{
 			name:    "test2",
 			args:    `This "is a test""`,
-			want:    "This",
-			want1:   []string{"is a test"},
-			wantErr: false,
+			wantErr: true,
 		},
 		{
 			name:    "test3",
@@ -73,6 +74,17 @@ func TestParseCmd(t *testing.T) {
 			want1:   []string{"b", "c", "d", "e", "f 'g' h"},
 			wantErr: false,
 		},
+		{
+			name:    "empty",
+			args:    "   ",
+			wantErr: true,
+		},
+		{
+			name:  "no expansion",
+			args:  `echo $HOME ~ *`,
+			want:  "echo",
+			want1: []string{"$HOME", "~", "*"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -90,3 +102,73 @@ func TestParseCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitWords(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.go", "b.go", "c.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, f), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := map[string]string{"NAME": "wf", "EMPTY": "", "HOME": "/home/wf", "SP": "a b"}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+	all := WordOpts{Lookup: lookup, Tilde: true, Glob: true}
+
+	tests := []struct {
+		name    string
+		cmd     string
+		opts    WordOpts
+		want    []string
+		wantPos int
+		wantErr bool
+	}{
+		{name: "escapes", cmd: `a\ b c\"d \\`, want: []string{"a b", `c"d`, `\`}},
+		{name: "mid word quotes", cmd: `--msg="a b" x'y z'w`, want: []string{"--msg=a b", "xy zw"}},
+		{name: "empty words", cmd: `a "" '' b`, want: []string{"a", "", "", "b"}},
+		{name: "double quote escapes", cmd: `"\$x \" \\ \n"`, want: []string{`$x " \ \n`}},
+		{name: "line continuation", cmd: "a \\\n b", want: []string{"a", "b"}},
+		{name: "empty", cmd: "", want: []string{}},
+		{name: "var", cmd: "echo $NAME-x ${NAME}y", opts: all, want: []string{"echo", "wf-x", "wfy"}},
+		{name: "var not split", cmd: "echo $SP", opts: all, want: []string{"echo", "a b"}},
+		{name: "var in double quotes", cmd: `"$NAME $UNSET."`, opts: all, want: []string{"wf ."}},
+		{name: "var in single quotes", cmd: `'$NAME'`, opts: all, want: []string{"$NAME"}},
+		{name: "default", cmd: "${UNSET:-d} ${EMPTY:-e} ${EMPTY-f} ${UNSET:-$NAME}", opts: all,
+			want: []string{"d", "e", "", "wf"}},
+		{name: "lone dollar", cmd: "$ $1 a$", opts: all, want: []string{"$", "$1", "a$"}},
+		{name: "tilde", cmd: "~ ~/x a~ '~' ~wf", opts: all, want: []string{"/home/wf", "/home/wf/x", "a~", "~", "~wf"}},
+		{name: "glob", cmd: dir + "/*.go", opts: all,
+			want: []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")}},
+		{name: "quoted glob", cmd: "'" + dir + "/*.go'", opts: all, want: []string{dir + "/*.go"}},
+		{name: "glob no match", cmd: dir + "/*.c", opts: all, want: []string{dir + "/*.c"}},
+		{name: "glob off", cmd: dir + "/*.go", opts: WordOpts{Lookup: lookup}, want: []string{dir + "/*.go"}},
+		{name: "unterminated single", cmd: "echo 'abc", wantPos: 5, wantErr: true},
+		{name: "unterminated double", cmd: `echo x"abc`, wantPos: 6, wantErr: true},
+		{name: "trailing backslash", cmd: `echo \`, wantPos: 5, wantErr: true},
+		{name: "unterminated brace", cmd: "echo ${NAME", opts: all, wantPos: 5, wantErr: true},
+		{name: "bad substitution", cmd: "echo ${1x}", opts: all, wantPos: 5, wantErr: true},
+		{name: "bad pattern", cmd: "a [", opts: all, wantPos: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitWords(tt.cmd, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SplitWords() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				var se *SyntaxError
+				if !errors.As(err, &se) || se.Pos != tt.wantPos {
+					t.Errorf("SplitWords() error = %v, want position %d", err, tt.wantPos)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitWords() got = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,14 +15,15 @@
 package rcparse
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig"
 	"gopkg.in/yaml.v3"
@@ -32,23 +33,110 @@ type RCFile interface {
 	Parse(r io.Reader) error
 	GetCommand(rule string) ([]string, bool)
 	GetCommandEnv(rule string) ([]string, map[string]string, bool)
+	CommandEnv(rule string) ([]string, map[string]string, error)
+	HookCommandEnv(rule string, hook string, status HookStatus) (CmdEnv, map[string]string, error)
+	GetDeps(rule string) ([]string, bool)
+	GetRule(rule string) (CmdEnv, bool)
+	SetArgs(rule string, args []string) error
+	GetArgs(rule string) []string
 	ListRules() ([]string, error)
 }
 
+var _ RCFile = (*YRCfile)(nil)
+
 type CmdEnv struct {
-	Cmd  []string
-	Envs map[string]string
+	Cmd []string
+	// Opts holds the options of each command in Cmd.
+	Opts        []CmdOpts
+	Envs        map[string]string
+	Deps        []string
+	Passthrough bool
+	Params      []Param
+	Timeout     time.Duration
+	TTY         bool
+	Stdin       string
+	EnvMode     string
+	EnvPass     []string
+	Dotenv      []string
+	Shell       string
+	// Interpreter runs the rule's script block.
+	Interpreter string
+	// Tilde and Glob turn on those expansions of commands run directly.
+	Tilde bool
+	Glob  bool
+	// Executor is the name of what runs the rule. Empty is the local one.
+	Executor string
+	// Sources and Generates are globs of the files the rule reads and
+	// writes, and Method how to tell whether it is up to date.
+	Sources   []string
+	Generates []string
+	Method    string
+	// Watch is globs of the files watch mode reruns the rule for,
+	// instead of its sources.
+	Watch []string
+	// Retry is how each command is retried, unless it says otherwise.
+	Retry RetryOpts
+	// ContinueOnError lets the rule fail without stopping anything else.
+	ContinueOnError bool
+	// Hooks are commands run around the rule's own.
+	Hooks Hooks
+	// Dir is where the rule's commands run and its globs are matched:
+	// the directory of the top level workflow file, which included and
+	// layered rules share. GetRule fills it in.
+	Dir string
+	// G and V are the globals and vars of the templates of a rule from a
+	// namespaced include: those of its own file, not the top level ones.
+	G map[string]string
+	V map[string]string
+	// File is the workflow file the rule came from, if it is known.
+	File string
 }
 
 type YRCfile struct {
 	G        map[string]string
 	Commands map[string]CmdEnv
+	// Env is added to the environment of every rule.
+	Env map[string]string
+	// V holds values for templates only.
+	V map[string]string
+	// Dotenv lists the dotenv files loaded for every rule.
+	Dotenv []string
+	// Shell is the shell commands are run under, for rules without one.
+	Shell string
+	// Hooks are run around every invocation.
+	Hooks Hooks
+	// Dir is where the top level workflow file is. Rules run in it, while
+	// dotenv files are relative to the file that names them.
+	Dir string
+	// File is the workflow file being read, if there is one.
+	File string
+	// Args holds the extra command line arguments given to each rule.
+	Args map[string][]string
+	// Params holds the parameter values given to each rule.
+	Params map[string]map[string]any
+
+	// including is the chain of files being included, to catch cycles.
+	including []string
 }
 
-func NewYRCFile(filename string) (*YRCfile, error) {
-	filename = filepath.Join("/", filepath.Clean(filename))
-	var fp, err = os.Open(filename)
+// tmplData is what the command templates of a rule are executed against.
+type tmplData struct {
+	G    map[string]string
+	V    map[string]string
+	Args []string
+	P    map[string]any
+
+	// Failed and ExitCode are set for hooks, see HookStatus.
+	Failed   string
+	ExitCode int
+}
 
+func NewYRCFile(filename string) (*YRCfile, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	fp, err := os.Open(filename) //nolint:gosec
 	if err != nil {
 		return nil, err
 	}
@@ -56,103 +144,461 @@ func NewYRCFile(filename string) (*YRCfile, error) {
 		_ = fp.Close()
 	}()
 
-	return CreateYRCFile(fp)
+	rc := newYRCfile()
+	rc.Dir = filepath.Dir(filename)
+	rc.File = filename
+	rc.including = []string{filename}
+	return rc, rc.Parse(fp)
+}
+
+// NewLayeredYRCFile reads the workflow files in order, as if they were
+// the documents of one file in dir. The includes and dotenv files of each
+// are relative to it, and its rules remember which it was.
+func NewLayeredYRCFile(dir string, files ...string) (*YRCfile, error) {
+	rc := newYRCfile()
+	for _, f := range files {
+		f = filepath.Join("/", filepath.Clean(f))
+		fp, err := os.Open(f)
+		if err != nil {
+			return rc, err
+		}
+
+		rc.Dir = filepath.Dir(f)
+		rc.File = f
+		rc.including = []string{f}
+		err = rc.Parse(fp)
+		_ = fp.Close()
+		if err != nil {
+			return rc, fmt.Errorf("%s: %w", f, err)
+		}
+	}
+
+	rc.Dir, rc.File, rc.including = dir, "", nil
+	return rc, nil
 }
 
 func CreateYRCFile(rd io.Reader) (*YRCfile, error) {
-	rv := YRCfile{
+	rv := newYRCfile()
+	return rv, rv.Parse(rd)
+}
+
+func newYRCfile() *YRCfile {
+	return &YRCfile{
 		Commands: make(map[string]CmdEnv),
 		G:        make(map[string]string),
+		Env:      make(map[string]string),
+		V:        make(map[string]string),
+		Args:     make(map[string][]string),
+		Params:   make(map[string]map[string]any),
 	}
-
-	return &rv, rv.Parse(rd)
 }
 
 type YRCFileEntry struct {
-	Rule     string            `yaml:"rule"`
-	Commands []string          `yaml:"c"`
-	Env      map[string]string `yaml:"env,omitempty"`
+	Rule        string            `yaml:"rule"`
+	Commands    []Command         `yaml:"c"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	Deps        []string          `yaml:"deps,omitempty"`
+	Passthrough bool              `yaml:"passthrough,omitempty"`
+	Params      []Param           `yaml:"params,omitempty"`
+	Timeout     time.Duration     `yaml:"timeout,omitempty"`
+	TTY         bool              `yaml:"tty,omitempty"`
+	Stdin       string            `yaml:"stdin,omitempty"`
+	EnvMode     string            `yaml:"env_mode,omitempty"`
+	EnvPass     []string          `yaml:"env_pass,omitempty"`
+	Dotenv      []string          `yaml:"dotenv,omitempty"`
+	Shell       string            `yaml:"shell,omitempty"`
+	Script      string            `yaml:"script,omitempty"`
+	Interpreter string            `yaml:"interpreter,omitempty"`
+	Tilde       bool              `yaml:"tilde,omitempty"`
+	Glob        bool              `yaml:"glob,omitempty"`
+	Executor    string            `yaml:"executor,omitempty"`
+	Sources     []string          `yaml:"sources,omitempty"`
+	Generates   []string          `yaml:"generates,omitempty"`
+	Method      string            `yaml:"method,omitempty"`
+	Watch       []string          `yaml:"watch,omitempty"`
+	RetryOpts   `yaml:",inline"`
+
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+	Hooks           `yaml:",inline"`
 }
 
+// NoShell as a rule's shell has its commands run directly, even when
+// there is a top level shell.
+const NoShell = "none"
+
+// How a rule with sources or generates is found to be up to date, and
+// skipped.
+const (
+	// MethodMtime skips the rule when everything it generates is newer
+	// than all of its sources. This is the default for rules that
+	// generate something.
+	MethodMtime = "mtime"
+	// MethodChecksum skips the rule when its sources and commands are the
+	// same as the last time it ran. This is the default for rules that
+	// only have sources.
+	MethodChecksum = "checksum"
+)
+
+// How much of wf's own environment the commands of a rule get, before
+// the rule's env is added.
+const (
+	// EnvInherit passes on all of it. This is the default.
+	EnvInherit = "inherit"
+	// EnvClean passes on none of it.
+	EnvClean = "clean"
+	// EnvAllowlist passes on only the variables listed in env_pass.
+	EnvAllowlist = "allowlist"
+)
+
 type YRCFormat struct {
 	Items   []YRCFileEntry    `yaml:"wf_file"`
 	Globals map[string]string `yaml:"globals,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Vars    map[string]string `yaml:"vars,omitempty"`
+	Dotenv  []string          `yaml:"dotenv,omitempty"`
+	Shell   string            `yaml:"shell,omitempty"`
+	Include Includes          `yaml:"include,omitempty"`
+	Hooks   `yaml:",inline"`
 }
 
+// Parse reads a workflow file from r. The file can hold several YAML
+// documents, separated by "---" lines, which are merged in order.
 func (rc *YRCfile) Parse(r io.Reader) error {
-	entries := YRCFormat{
-		Items:   make([]YRCFileEntry, 10, 11),
-		Globals: make(map[string]string, 10),
-	}
-
-	br := bufio.NewReader(r)
-	fileBuf := make([]byte, 4095, 4096)
+	dec := yaml.NewDecoder(r)
+	docs := 0
+	for {
+		var entries YRCFormat
+		err := dec.Decode(&entries)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if docs > 0 {
+				return fmt.Errorf("document %d: %w", docs+1, err)
+			}
+			return err
+		}
+		docs++
 
-	size, err := br.Read(fileBuf)
-	if err != nil {
-		return err
+		if err := rc.add(entries); err != nil {
+			return err
+		}
 	}
-	if size == 0 {
+	if docs == 0 {
 		return fmt.Errorf("empty rc file")
 	}
 
-	fileBuf = fileBuf[0:size]
+	return nil
+}
 
-	err = yaml.Unmarshal(fileBuf, &entries)
-	if err != nil {
-		return err
+// add merges one document of a workflow file into rc. Its includes come
+// first. Rules replace rules of the same name from earlier documents and
+// includes, and top level settings are added to theirs.
+func (rc *YRCfile) add(entries YRCFormat) error {
+	if rc.Commands == nil {
+		rc.Commands = make(map[string]CmdEnv)
+	}
+	if rc.G == nil {
+		rc.G = make(map[string]string)
+	}
+	if rc.Env == nil {
+		rc.Env = make(map[string]string)
+	}
+	if rc.V == nil {
+		rc.V = make(map[string]string)
 	}
 
+	for _, inc := range entries.Include {
+		if err := rc.include(inc); err != nil {
+			return &includeError{err}
+		}
+	}
+
+	seen := map[string]bool{}
 	for _, entry := range entries.Items {
-		newRule := CmdEnv{Cmd: []string{}, Envs: map[string]string{}}
+		if seen[entry.Rule] {
+			return &ruleError{entry.Rule, errRuleTwice}
+		}
+		seen[entry.Rule] = true
+		newRule := CmdEnv{Cmd: []string{}, Envs: map[string]string{}, Deps: []string{}}
+
+		for _, c := range entry.Commands {
+			newRule.Cmd = append(newRule.Cmd, c.Cmd)
+			newRule.Opts = append(newRule.Opts, c.CmdOpts)
+		}
+		if entry.Script != "" {
+			newRule.Cmd = append(newRule.Cmd, entry.Script)
+			newRule.Opts = append(newRule.Opts, CmdOpts{Script: true})
+		} else if entry.Interpreter != "" {
+			return &ruleError{entry.Rule, errors.New("interpreter needs a script")}
+		}
+		newRule.Interpreter = entry.Interpreter
+		newRule.Tilde = entry.Tilde
+		newRule.Glob = entry.Glob
+		newRule.Executor = entry.Executor
+		newRule.Sources = append(newRule.Sources, entry.Sources...)
+		newRule.Generates = append(newRule.Generates, entry.Generates...)
+		newRule.Watch = append(newRule.Watch, entry.Watch...)
+		if err := entry.RetryOpts.check(); err != nil {
+			return &ruleError{entry.Rule, err}
+		}
+		newRule.Retry = entry.RetryOpts
+		newRule.ContinueOnError = entry.ContinueOnError
+		newRule.Hooks = entry.Hooks
+		for _, c := range entry.Commands {
+			if err := c.RetryOpts.check(); err != nil {
+				return &ruleError{entry.Rule, fmt.Errorf("command %q: %w", c.Cmd, err)}
+			}
+		}
+		switch {
+		case entry.Method == MethodMtime, entry.Method == MethodChecksum:
+			newRule.Method = entry.Method
+		case entry.Method != "":
+			return &ruleError{entry.Rule, fmt.Errorf("unknown method %s", entry.Method)}
+		case len(entry.Generates) > 0:
+			newRule.Method = MethodMtime
+		case len(entry.Sources) > 0:
+			newRule.Method = MethodChecksum
+		}
+		newRule.Deps = append(newRule.Deps, entry.Deps...)
+		newRule.Passthrough = entry.Passthrough
+		newRule.Timeout = entry.Timeout
+		newRule.TTY = entry.TTY
+		newRule.Stdin = entry.Stdin
+
+		switch entry.EnvMode {
+		case "":
+			newRule.EnvMode = EnvInherit
+		case EnvInherit, EnvClean, EnvAllowlist:
+			newRule.EnvMode = entry.EnvMode
+		default:
+			return &ruleError{entry.Rule, fmt.Errorf("unknown env_mode %s", entry.EnvMode)}
+		}
+		if len(entry.EnvPass) > 0 && newRule.EnvMode != EnvAllowlist {
+			return &ruleError{entry.Rule, fmt.Errorf("env_pass needs env_mode: %s", EnvAllowlist)}
+		}
+		newRule.EnvPass = append(newRule.EnvPass, entry.EnvPass...)
+		newRule.Dotenv = append(newRule.Dotenv, rc.dotenvPaths(entry.Dotenv)...)
+		newRule.Shell = entry.Shell
 
-		newRule.Cmd = append(newRule.Cmd, entry.Commands...)
+		if err := checkParams(entry.Params); err != nil {
+			return &ruleError{entry.Rule, err}
+		}
+		newRule.Params = append(newRule.Params, entry.Params...)
 
 		for k, v := range entry.Env {
 			newRule.Envs[k] = v
 		}
 
+		newRule.File = rc.File
 		rc.Commands[entry.Rule] = newRule
 	}
 
 	for k, v := range entries.Globals {
 		rc.G[k] = v
 	}
+	for k, v := range entries.Env {
+		rc.Env[k] = v
+	}
+	for k, v := range entries.Vars {
+		rc.V[k] = v
+	}
+	rc.Dotenv = append(rc.Dotenv, rc.dotenvPaths(entries.Dotenv)...)
+	if entries.Shell != "" {
+		rc.Shell = entries.Shell
+	}
+	rc.Hooks = rc.Hooks.merge(entries.Hooks)
 
 	return nil
 }
 
+// dotenvPaths returns files relative to the workflow file being read,
+// so they are still found once its rules are merged into another's.
+func (rc *YRCfile) dotenvPaths(files []string) []string {
+	rv := make([]string, 0, len(files))
+	for _, f := range files {
+		if rc.Dir != "" && !filepath.IsAbs(f) {
+			f = filepath.Join(rc.Dir, f)
+		}
+		rv = append(rv, f)
+	}
+	return rv
+}
+
 func (rc *YRCfile) GetCommand(rule string) ([]string, bool) {
 	cmd, _, exists := rc.GetCommandEnv(rule)
 	return cmd, exists
 }
 
+// GetCommandEnv is CommandEnv, for callers that only need to know whether
+// it worked. Use CommandEnv to find out why it didn't.
 func (rc *YRCfile) GetCommandEnv(rule string) ([]string, map[string]string, bool) {
+	cmd, env, err := rc.CommandEnv(rule)
+	if err != nil {
+		return []string{}, nil, false
+	}
+	return cmd, env, true
+}
+
+// CommandEnv returns the commands of rule, with their templates executed,
+// and the environment they are run with.
+func (rc *YRCfile) CommandEnv(rule string) ([]string, map[string]string, error) {
 	val, exists := rc.Commands[rule]
 	if !exists {
-		return []string{}, nil, exists
+		return []string{}, nil, fmt.Errorf("%w: %s", ErrRuleNotFound, rule)
 	}
 
-	rv := []string{}
+	params, err := rc.ruleParams(rule, val)
+	if err != nil {
+		return []string{}, nil, err
+	}
+
+	data := rc.tmplData(val)
+	data.Args, data.P = rc.GetArgs(rule), params
+	rv, err := expandCommands(rule, val.Cmd, data)
+	if err != nil {
+		return []string{}, nil, err
+	}
+
+	env, err := rc.ruleEnv(val)
+	if err != nil {
+		return []string{}, nil, fmt.Errorf("rule %s: %w", rule, err)
+	}
+	return rv, env, nil
+}
+
+// tmplData returns what the templates of val are executed against,
+// before its arguments and parameters are added.
+func (rc *YRCfile) tmplData(val CmdEnv) tmplData {
+	if val.V != nil {
+		return tmplData{G: val.G, V: val.V}
+	}
+	return tmplData{G: rc.G, V: rc.V}
+}
 
-	for _, c := range val.Cmd {
+// ruleParams returns the values of the parameters of rule, as given to
+// SetArgs or else their defaults.
+func (rc *YRCfile) ruleParams(rule string, val CmdEnv) (map[string]any, error) {
+	if params, bound := rc.Params[rule]; bound {
+		return params, nil
+	}
+	params, _, err := bindParams(val.Params, nil)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: %w", rule, err)
+	}
+	return params, nil
+}
+
+// expandCommands executes the templates of the commands of rule.
+func expandCommands(rule string, cmds []string, data tmplData) ([]string, error) {
+	rv := []string{}
+	for i, c := range cmds {
 		t := template.New("Cmd").Funcs(sprig.FuncMap())
 		tmlp, err := t.Parse(c)
 		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "error in template %v", err)
-			return []string{}, nil, false
+			return nil, &TemplateError{Rule: rule, Line: i + 1, Err: err}
 		}
 
 		var b strings.Builder
-		err = tmlp.Execute(&b, rc)
+		err = tmlp.Execute(&b, data)
 		if err != nil {
-			_, _ = fmt.Fprintf(os.Stderr, "error executing template: %v", err)
+			return nil, &TemplateError{Rule: rule, Line: i + 1, Err: err}
 		}
 
 		rv = append(rv, b.String())
-		b.Reset()
 	}
-	return rv, val.Envs, exists
+	return rv, nil
+}
+
+// ruleEnv builds the environment of a rule, from the top level dotenv
+// files and env, then the rule's own dotenv files and env, with each
+// winning over what came before.
+func (rc *YRCfile) ruleEnv(val CmdEnv) (map[string]string, error) {
+	env := make(map[string]string, len(rc.Env)+len(val.Envs))
+	lookup := func(key string) (string, bool) {
+		if v, ok := env[key]; ok {
+			return v, true
+		}
+		return os.LookupEnv(key)
+	}
+
+	layers := []struct {
+		dotenv []string
+		env    map[string]string
+	}{
+		{rc.Dotenv, rc.Env},
+		{val.Dotenv, val.Envs},
+	}
+	for _, layer := range layers {
+		vars, err := LoadDotenv(rc.Dir, layer.dotenv, lookup)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range vars {
+			env[k] = v
+		}
+		for k, v := range layer.env {
+			env[k] = v
+		}
+	}
+	return env, nil
+}
+
+// GetDeps returns the rules that must be run before rule.
+func (rc *YRCfile) GetDeps(rule string) ([]string, bool) {
+	val, exists := rc.Commands[rule]
+	if !exists {
+		return []string{}, exists
+	}
+	return val.Deps, exists
+}
+
+// GetRule returns everything known about rule, with the commands
+// not yet templated and top level defaults filled in.
+func (rc *YRCfile) GetRule(rule string) (CmdEnv, bool) {
+	val, exists := rc.Commands[rule]
+	if val.Shell == "" {
+		val.Shell = rc.Shell
+	}
+	if val.Dir == "" {
+		val.Dir = rc.Dir
+	}
+	return val, exists
+}
+
+// SetArgs sets the extra command line arguments for rule. Arguments
+// matching the rule's parameters are checked and made available to its
+// templates as .P; the rest are available as .Args.
+func (rc *YRCfile) SetArgs(rule string, args []string) error {
+	if rc.Args == nil {
+		rc.Args = make(map[string][]string)
+	}
+	if rc.Params == nil {
+		rc.Params = make(map[string]map[string]any)
+	}
+
+	val, exists := rc.Commands[rule]
+	if !exists {
+		rc.Args[rule] = args
+		return nil
+	}
+
+	params, rest, err := bindParams(val.Params, args)
+	if err != nil {
+		return fmt.Errorf("rule %s: %w", rule, err)
+	}
+
+	rc.Args[rule] = rest
+	rc.Params[rule] = params
+	return nil
+}
+
+func (rc *YRCfile) GetArgs(rule string) []string {
+	args, exists := rc.Args[rule]
+	if !exists {
+		return []string{}
+	}
+	return args
 }
 
 func (rc *YRCfile) ListRules() ([]string, error) {
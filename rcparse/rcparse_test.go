@@ -13,9 +13,16 @@ package rcparse
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 const YamlFile = `
@@ -40,6 +47,7 @@ wf_file:
         test. tada!
       - foo
   - rule: delta
+    deps: [alpha, beta]
     c: 
       - '{{.G.test}} {{.G.bob}}'
 `
@@ -108,3 +116,511 @@ func TestYTRCFile_Parse(t *testing.T) {
 		})
 	}
 }
+
+func TestYRCfile_GetDeps(t *testing.T) {
+	rc, err := CreateYRCFile(bytes.NewBufferString(YamlFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rule   string
+		want   []string
+		exists bool
+	}{
+		{
+			name:   "test1",
+			rule:   "delta",
+			want:   []string{"alpha", "beta"},
+			exists: true,
+		},
+		{
+			name:   "test2",
+			rule:   "alpha",
+			want:   []string{},
+			exists: true,
+		},
+		{
+			name:   "test3",
+			rule:   "missing",
+			want:   []string{},
+			exists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exists := rc.GetDeps(tt.rule)
+			if exists != tt.exists {
+				t.Errorf("GetDeps() exists = %v, want %v", exists, tt.exists)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GetDeps() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const ArgsFile = `
+globals:
+  msg: 'a "quoted" <value>'
+wf_file:
+  - rule: first
+    c:
+      - echo {{index .Args 0}}
+  - rule: all
+    c:
+      - echo {{join " " .Args}}
+  - rule: quoted
+    c:
+      - echo {{.G.msg}}
+`
+
+func TestYRCfile_Args(t *testing.T) {
+	rc, err := CreateYRCFile(bytes.NewBufferString(ArgsFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		args []string
+		want string
+	}{
+		{
+			name: "index",
+			rule: "first",
+			args: []string{"-run", "TestFoo"},
+			want: "echo -run",
+		},
+		{
+			name: "join",
+			rule: "all",
+			args: []string{"-run", "TestFoo", "./pkg/..."},
+			want: "echo -run TestFoo ./pkg/...",
+		},
+		{
+			name: "no args",
+			rule: "all",
+			args: []string{},
+			want: "echo ",
+		},
+		{
+			name: "not escaped",
+			rule: "quoted",
+			args: nil,
+			want: `echo a "quoted" <value>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.args != nil {
+				if err := rc.SetArgs(tt.rule, tt.args); err != nil {
+					t.Errorf("SetArgs() error = %v", err)
+				}
+			}
+			cmd, exists := rc.GetCommand(tt.rule)
+			if !exists || len(cmd) != 1 || cmd[0] != tt.want {
+				t.Errorf("GetCommand() got = %q exists: %v, want %q", cmd, exists, tt.want)
+			}
+			if tt.args != nil && !slices.Equal(rc.GetArgs(tt.rule), tt.args) {
+				t.Errorf("GetArgs() got = %v, want %v", rc.GetArgs(tt.rule), tt.args)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseEnvMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		wantMode string
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			yaml:     "wf_file: [{rule: a, c: [echo]}]",
+			wantMode: EnvInherit,
+		},
+		{
+			name:     "clean",
+			yaml:     "wf_file: [{rule: a, c: [echo], env_mode: clean}]",
+			wantMode: EnvClean,
+		},
+		{
+			name:     "allowlist",
+			yaml:     "wf_file: [{rule: a, c: [echo], env_mode: allowlist, env_pass: [PATH]}]",
+			wantMode: EnvAllowlist,
+		},
+		{
+			name:    "unknown",
+			yaml:    "wf_file: [{rule: a, c: [echo], env_mode: some}]",
+			wantErr: true,
+		},
+		{
+			name:    "pass without allowlist",
+			yaml:    "wf_file: [{rule: a, c: [echo], env_pass: [PATH]}]",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(bytes.NewBufferString(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if r, _ := rc.GetRule("a"); r.EnvMode != tt.wantMode {
+				t.Errorf("Parse() env mode = %v, want %v", r.EnvMode, tt.wantMode)
+			}
+		})
+	}
+}
+
+const GlobalEnvFile = `
+env:
+  GOFLAGS: -mod=mod
+  SHARED: top
+vars:
+  pkg: ./...
+wf_file:
+  - rule: test
+    c:
+      - go test {{.V.pkg}}
+    env:
+      SHARED: rule
+  - rule: build
+    c:
+      - go build {{.V.pkg}}
+`
+
+func TestYRCfile_GlobalEnv(t *testing.T) {
+	rc, err := CreateYRCFile(bytes.NewBufferString(GlobalEnvFile))
+	if err != nil {
+		t.Fatalf("Unable to parse test rcfile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		cmd  string
+		env  map[string]string
+	}{
+		{
+			name: "rule env wins",
+			rule: "test",
+			cmd:  "go test ./...",
+			env:  map[string]string{"GOFLAGS": "-mod=mod", "SHARED": "rule"},
+		},
+		{
+			name: "top level env only",
+			rule: "build",
+			cmd:  "go build ./...",
+			env:  map[string]string{"GOFLAGS": "-mod=mod", "SHARED": "top"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, env, exists := rc.GetCommandEnv(tt.rule)
+			if !exists || cmd[0] != tt.cmd {
+				t.Errorf("GetCommandEnv() got = %v, want %v", cmd, tt.cmd)
+			}
+			if !maps.Equal(env, tt.env) {
+				t.Errorf("GetCommandEnv() env = %v, want %v", env, tt.env)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		wantCmd  []string
+		wantOpts []CmdOpts
+		wantErr  bool
+	}{
+		{
+			name:     "script only",
+			yaml:     "wf_file: [{rule: a, script: \"echo {{.V.x}}\\n\"}]\nvars: {x: hi}",
+			wantCmd:  []string{"echo hi\n"},
+			wantOpts: []CmdOpts{{Script: true}},
+		},
+		{
+			name:     "after commands",
+			yaml:     "wf_file: [{rule: a, c: [true], script: exit 0, interpreter: bash}]",
+			wantCmd:  []string{"true", "exit 0"},
+			wantOpts: []CmdOpts{{}, {Script: true}},
+		},
+		{
+			name:    "interpreter without script",
+			yaml:    "wf_file: [{rule: a, c: [true], interpreter: bash}]",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(bytes.NewBufferString(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			cmd, _, _ := rc.GetCommandEnv("a")
+			if !slices.Equal(cmd, tt.wantCmd) {
+				t.Errorf("GetCommandEnv() got = %q, want %q", cmd, tt.wantCmd)
+			}
+			if r, _ := rc.GetRule("a"); !reflect.DeepEqual(r.Opts, tt.wantOpts) {
+				t.Errorf("GetRule() opts = %+v, want %+v", r.Opts, tt.wantOpts)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseMethod(t *testing.T) {
+	tests := []struct {
+		name       string
+		yaml       string
+		wantMethod string
+		wantErr    bool
+	}{
+		{name: "none", yaml: "wf_file: [{rule: a, c: [echo]}]", wantMethod: ""},
+		{name: "sources only", yaml: "wf_file: [{rule: a, c: [echo], sources: ['*.go']}]", wantMethod: MethodChecksum},
+		{name: "generates", yaml: "wf_file: [{rule: a, c: [echo], sources: ['*.go'], generates: [bin/a]}]",
+			wantMethod: MethodMtime},
+		{name: "explicit", yaml: "wf_file: [{rule: a, c: [echo], generates: [a], method: checksum}]",
+			wantMethod: MethodChecksum},
+		{name: "unknown", yaml: "wf_file: [{rule: a, c: [echo], method: hash}]", wantErr: true},
+		{name: "negative retries", yaml: "wf_file: [{rule: a, c: [echo], retries: -1}]", wantErr: true},
+		{name: "negative command delay", yaml: "wf_file: [{rule: a, c: [{cmd: echo, retry_delay: -1s}]}]",
+			wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(bytes.NewBufferString(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if r, _ := rc.GetRule("a"); r.Method != tt.wantMethod {
+				t.Errorf("Parse() method = %v, want %v", r.Method, tt.wantMethod)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseDuplicate(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{name: "same document", yaml: "wf_file: [{rule: a, c: [echo one]}, {rule: a, c: [echo two]}]", wantErr: true},
+		{name: "later document", yaml: "wf_file: [{rule: a, c: [echo one]}]\n---\nwf_file: [{rule: a, c: [echo two]}]",
+			want: "echo two"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(bytes.NewBufferString(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if cmd, _ := rc.GetCommand("a"); cmd[0] != tt.want {
+				t.Errorf("GetCommand() got = %v, want %v", cmd[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseLarge(t *testing.T) {
+	bigFile := func(rules int, cmds int) string {
+		var b strings.Builder
+		b.WriteString("vars:\n  pkg: ./...\nwf_file:\n")
+		for i := 0; i < rules; i++ {
+			fmt.Fprintf(&b, "  - rule: rule%d\n    c:\n", i)
+			for j := 0; j < cmds; j++ {
+				fmt.Fprintf(&b, "      - echo rule %d command %d {{.V.pkg}}\n", i, j)
+			}
+		}
+		return b.String()
+	}
+
+	tests := []struct {
+		name  string
+		rules int
+		cmds  int
+	}{
+		{name: "just over 4k", rules: 40, cmds: 3},
+		{name: "monorepo", rules: 300, cmds: 5},
+		{name: "one long rule", rules: 1, cmds: 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yml := bigFile(tt.rules, tt.cmds)
+			if len(yml) <= 4096 {
+				t.Fatalf("test file is only %d bytes", len(yml))
+			}
+
+			rc, err := CreateYRCFile(iotest.OneByteReader(strings.NewReader(yml)))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if rules, _ := rc.ListRules(); len(rules) != tt.rules {
+				t.Errorf("ListRules() got %d rules, want %d", len(rules), tt.rules)
+			}
+
+			last := tt.rules - 1
+			cmd, _, exists := rc.GetCommandEnv(fmt.Sprintf("rule%d", last))
+			want := fmt.Sprintf("echo rule %d command %d ./...", last, tt.cmds-1)
+			if !exists || len(cmd) != tt.cmds || cmd[len(cmd)-1] != want {
+				t.Errorf("GetCommandEnv() got %d commands, want %d ending %q", len(cmd), tt.cmds, want)
+			}
+		})
+	}
+}
+
+func TestYRCfile_ParseDocuments(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		rule    string
+		wantCmd []string
+		wantEnv map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "rules from both",
+			yaml:    "wf_file: [{rule: a, c: [echo a]}]\n---\nwf_file: [{rule: b, c: [echo b]}]\n",
+			rule:    "a",
+			wantCmd: []string{"echo a"},
+			wantEnv: map[string]string{},
+		},
+		{
+			name:    "later rule wins",
+			yaml:    "wf_file: [{rule: a, c: [echo a]}]\n---\nwf_file: [{rule: a, c: [echo again]}]\n",
+			rule:    "a",
+			wantCmd: []string{"echo again"},
+			wantEnv: map[string]string{},
+		},
+		{
+			name: "top level merged",
+			yaml: "vars: {x: one, y: two}\nenv: {A: a, B: b}\n---\nvars: {y: three}\nenv: {B: c}\n" +
+				"wf_file: [{rule: a, c: ['{{.V.x}} {{.V.y}}']}]\n",
+			rule:    "a",
+			wantCmd: []string{"one three"},
+			wantEnv: map[string]string{"A": "a", "B": "c"},
+		},
+		{
+			name:    "empty document",
+			yaml:    "---\n---\nwf_file: [{rule: a, c: [echo a]}]\n",
+			rule:    "a",
+			wantCmd: []string{"echo a"},
+			wantEnv: map[string]string{},
+		},
+		{
+			name:    "empty file",
+			yaml:    "",
+			wantErr: true,
+		},
+		{
+			name:    "bad second document",
+			yaml:    "wf_file: [{rule: a, c: [echo a]}]\n---\nwf_file: {rule\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := CreateYRCFile(strings.NewReader(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			cmd, env, _ := rc.GetCommandEnv(tt.rule)
+			if !slices.Equal(cmd, tt.wantCmd) {
+				t.Errorf("GetCommandEnv() got = %q, want %q", cmd, tt.wantCmd)
+			}
+			if !maps.Equal(env, tt.wantEnv) {
+				t.Errorf("GetCommandEnv() env = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestNewLayeredYRCFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config/wf/workflow.yaml": "include: [shared.yaml]\ndotenv: [user.env]\nvars: {who: user, editor: vi}\n" +
+			"wf_file:\n  - rule: hello\n    c: ['echo {{.V.who}} {{.V.editor}}']\n  - rule: build\n    c: [make]\n",
+		"config/wf/shared.yaml":        "wf_file:\n  - rule: clean\n    c: [rm -r build]\n",
+		"config/wf/user.env":           "EDITOR=vim\n",
+		"project/.workflow.yaml":       "vars: {who: project}\nwf_file:\n  - rule: build\n    c: [go build]\n",
+		"project/.workflow.local.yaml": "vars: {who: me}\nwf_file:\n  - rule: test\n    c: [go test -short]\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project := filepath.Join(dir, "project")
+
+	rc, err := NewLayeredYRCFile(project, filepath.Join(dir, "config/wf/workflow.yaml"),
+		filepath.Join(project, ".workflow.yaml"), filepath.Join(project, ".workflow.local.yaml"))
+	if err != nil {
+		t.Fatalf("NewLayeredYRCFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		wantCmd  []string
+		wantFile string
+	}{
+		{name: "later vars win", rule: "hello", wantCmd: []string{"echo me vi"}, wantFile: "config/wf/workflow.yaml"},
+		{name: "project rule wins", rule: "build", wantCmd: []string{"go build"}, wantFile: "project/.workflow.yaml"},
+		{name: "local rule", rule: "test", wantCmd: []string{"go test -short"}, wantFile: "project/.workflow.local.yaml"},
+		{name: "include in a layer", rule: "clean", wantCmd: []string{"rm -r build"}, wantFile: "config/wf/shared.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, env, err := rc.CommandEnv(tt.rule)
+			if err != nil || !slices.Equal(cmd, tt.wantCmd) {
+				t.Errorf("CommandEnv() got = %q, %v, want %q", cmd, err, tt.wantCmd)
+			}
+			if env["EDITOR"] != "vim" {
+				t.Errorf("CommandEnv() EDITOR = %q, want the user layer's dotenv", env["EDITOR"])
+			}
+			r, _ := rc.GetRule(tt.rule)
+			if r.File != filepath.Join(dir, tt.wantFile) {
+				t.Errorf("GetRule() file = %s, want %s", r.File, filepath.Join(dir, tt.wantFile))
+			}
+			if r.Dir != project {
+				t.Errorf("GetRule() dir = %s, want %s", r.Dir, project)
+			}
+		})
+	}
+
+	if _, err := NewLayeredYRCFile(project, filepath.Join(dir, "nothere.yaml")); err == nil {
+		t.Errorf("NewLayeredYRCFile() of a missing file didn't fail")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// SchemaID is the JSON Schema draft the schema of workflow files follows.
+const SchemaID = "http://json-schema.org/draft-07/schema#"
+
+// keyDocs describes the keys of a workflow file, for the schema. Keys
+// that mean the same at the top level and in a rule share a description.
+var keyDocs = map[string]string{
+	"wf_file":             "The rules.",
+	"include":             "Other workflow files to take rules from, relative to this one. As a mapping, the rules of each are named <namespace>:<rule>.",
+	"globals":             "Template values, available as .G.<name>. Older name for vars.",
+	"vars":                "Template values, available as .V.<name>.",
+	"env":                 "Environment variables for the commands.",
+	"dotenv":              "Dotenv files to load, relative to the file that names them.",
+	"shell":               "Shell to run each command under, e.g. \"bash -euo pipefail -c\". \"none\" runs them directly.",
+	"before":              "Commands run first.",
+	"after":               "Commands run once everything else succeeded.",
+	"on_failure":          "Commands run if anything failed.",
+	"finally":             "Commands run last, whatever happened.",
+	"rule":                "Name of the rule.",
+	"c":                   "Commands, run in order. Each one is a Go template.",
+	"deps":                "Rules that have to run first.",
+	"passthrough":         "Append the extra command line arguments to each command.",
+	"params":              "Named parameters of the rule, available to templates as .P.<name>.",
+	"timeout":             "How long it may take, e.g. 5m.",
+	"tty":                 "Run each command on a pseudo terminal of its own.",
+	"stdin":               "File fed to each command as its input, relative to where it runs.",
+	"env_mode":            "How much of wf's own environment the commands get.",
+	"env_pass":            "With env_mode allowlist, the variables to pass on.",
+	"script":              "A multi line script, run after the commands in c.",
+	"interpreter":         "What runs the script, e.g. bash or python3.",
+	"tilde":               "Expand a leading ~ in commands run directly.",
+	"glob":                "Expand file patterns in commands run directly.",
+	"executor":            "What runs the rule: local, or the name of a registered executor.",
+	"sources":             "Globs of the files the rule reads, relative to the top level workflow file.",
+	"generates":           "Globs of the files the rule writes, relative to the top level workflow file.",
+	"method":              "How to tell the rule is up to date, and can be skipped.",
+	"watch":               "Globs of the files wf -w watches for this rule, instead of its sources.",
+	"retries":             "How many more times to try a failing command.",
+	"retry_delay":         "Wait before the first retry, doubling for each one after it, e.g. 1s.",
+	"retry_on_exit_codes": "Retry only for these exit codes.",
+	"continue_on_error":   "Only report a failure of this rule, and carry on.",
+	"cmd":                 "The command, a Go template.",
+	"ignore_error":        "Carry on with the rule if this command fails.",
+	"name":                "Name of the parameter.",
+	"type":                "Type of the parameter.",
+	"default":             "Value of the parameter when it isn't given.",
+	"required":            "The parameter has to be given.",
+	"help":                "What the parameter is for.",
+	"values":              "With type enum, the values allowed.",
+}
+
+// keyEnums are the values allowed for keys that take one of a few.
+var keyEnums = map[string][]string{
+	"env_mode": {EnvInherit, EnvClean, EnvAllowlist},
+	"method":   {MethodMtime, MethodChecksum},
+	"type":     {ParamString, ParamInt, ParamBool, ParamEnum},
+}
+
+// keyRequired are the keys that can't be left out.
+var keyRequired = map[reflect.Type][]string{
+	reflect.TypeOf(YRCFileEntry{}): {"rule"},
+	reflect.TypeOf(Command{}):      {"cmd"},
+	reflect.TypeOf(Param{}):        {"name"},
+}
+
+// Schema returns a JSON Schema for workflow files, for editors to
+// complete and check them with. It is built from the types the files are
+// read into.
+func Schema() ([]byte, error) {
+	s := schemaOf(reflect.TypeOf(YRCFormat{}))
+	s["$schema"] = SchemaID
+	s["title"] = "wf workflow file"
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// scalar is what a string can be given as: the yaml package takes numbers
+// and booleans for strings too.
+var scalar = []string{"string", "number", "boolean"}
+
+func schemaOf(t reflect.Type) map[string]any {
+	switch t {
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "string", "pattern": `^(0|(\d+(\.\d*)?(ns|us|µs|ms|s|m|h))+)$`}
+	case reflect.TypeOf(Includes{}):
+		return map[string]any{"oneOf": []any{
+			map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+		}}
+	case reflect.TypeOf(Command{}):
+		// a plain string, or a mapping with the command and its options
+		return map[string]any{"oneOf": []any{map[string]any{"type": scalar}, structSchema(t)}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": scalar}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	panic(fmt.Sprintf("rcparse: no schema for %v", t))
+}
+
+func structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	for key, ft := range yamlFields(t, map[string]reflect.Type{}) {
+		p := schemaOf(ft)
+		if doc := keyDocs[key]; doc != "" {
+			p["description"] = doc
+		}
+		if enum := keyEnums[key]; enum != nil {
+			p["enum"] = enum
+		}
+		props[key] = p
+	}
+
+	s := map[string]any{"type": "object", "properties": props, "additionalProperties": false}
+	if req := keyRequired[t]; req != nil {
+		s["required"] = req
+	}
+	return s
+}
+
+// schemaKeys lists the keys of workflow files the schema knows, for
+// tests.
+func schemaKeys() []string {
+	keys := []string{}
+	var walk func(t reflect.Type)
+	seen := map[reflect.Type]bool{}
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || t == reflect.TypeOf(Include{}) || seen[t] {
+			return
+		}
+		seen[t] = true
+		for key, ft := range yamlFields(t, map[string]reflect.Type{}) {
+			keys = append(keys, key)
+			walk(ft)
+		}
+	}
+	walk(reflect.TypeOf(YRCFormat{}))
+	return keys
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package rcparse
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSchema(t *testing.T) {
+	got, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+
+	want, err := os.ReadFile("../workflow.schema.json")
+	if err != nil {
+		t.Fatalf("Unable to read schema: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("workflow.schema.json is out of date, run make schema")
+	}
+}
+
+func TestSchemaKeys(t *testing.T) {
+	keys := schemaKeys()
+	for _, k := range keys {
+		if _, ok := keyDocs[k]; !ok {
+			t.Errorf("no description for %s", k)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, k := range keys {
+		known[k] = true
+	}
+	documented := []string{}
+	for k := range keyDocs {
+		documented = append(documented, k)
+	}
+	for k := range keyEnums {
+		documented = append(documented, k)
+	}
+	slices.Sort(documented)
+	for _, k := range documented {
+		if !known[k] {
+			t.Errorf("no key for %s", k)
+		}
+	}
+}
+
+func TestSchemaDuration(t *testing.T) {
+	pattern := regexp.MustCompile(schemaOf(reflect.TypeOf(time.Duration(0)))["pattern"].(string))
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "0", want: true},
+		{value: "1.5s", want: true},
+		{value: "1h30m", want: true},
+		{value: "5", want: false},
+		{value: "00", want: false},
+		{value: "soon", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := pattern.MatchString(tt.value); got != tt.want {
+				t.Errorf("pattern matches %q = %v, want %v", tt.value, got, tt.want)
+			}
+			if _, err := time.ParseDuration(tt.value); (err == nil) != tt.want {
+				t.Errorf("ParseDuration(%q) error = %v, want ok %v", tt.value, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package termui
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+var ruleColors = []color.Attribute{
+	color.FgHiCyan,
+	color.FgHiMagenta,
+	color.FgHiYellow,
+	color.FgHiBlue,
+	color.FgCyan,
+	color.FgMagenta,
+	color.FgYellow,
+	color.FgBlue,
+}
+
+// RuleColor returns the color used to label the output of the i'th rule.
+func RuleColor(i int) *color.Color {
+	return color.New(ruleColors[i%len(ruleColors)])
+}
+
+// PrefixWriter buffers what is written to it and passes it on to an
+// underlying writer one complete line at a time, with a prefix in front
+// of every line. PrefixWriters sharing a mutex never interleave lines.
+type PrefixWriter struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	prefix []byte
+	buf    []byte
+}
+
+func NewPrefixWriter(out io.Writer, mu *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{mu: mu, out: out, prefix: []byte(prefix)}
+}
+
+func (p *PrefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+
+	err := p.writeLines(p.buf[:i+1])
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush writes out a trailing partial line, if there is one.
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	err := p.writeLines(append(p.buf, '\n'))
+	p.buf = p.buf[:0]
+	return err
+}
+
+func (p *PrefixWriter) writeLines(lines []byte) error {
+	out := make([]byte, 0, len(lines)+len(p.prefix)*8)
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		out = append(out, p.prefix...)
+		out = append(out, lines[:i+1]...)
+		lines = lines[i+1:]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.out.Write(out)
+	return err
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package termui
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name:   "single line",
+			writes: []string{"hello\n"},
+			want:   "[a] hello\n",
+		},
+		{
+			name:   "split line",
+			writes: []string{"hel", "lo\nwor", "ld\n"},
+			want:   "[a] hello\n[a] world\n",
+		},
+		{
+			name:   "several lines in one write",
+			writes: []string{"one\ntwo\nthree\n"},
+			want:   "[a] one\n[a] two\n[a] three\n",
+		},
+		{
+			name:   "partial line flushed",
+			writes: []string{"one\ntw", "o"},
+			want:   "[a] one\n[a] two\n",
+		},
+		{
+			name:   "nothing",
+			writes: []string{},
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := NewPrefixWriter(&out, &sync.Mutex{}, "[a] ")
+			for _, w := range tt.writes {
+				n, err := p.Write([]byte(w))
+				if err != nil || n != len(w) {
+					t.Errorf("Write() = %v, %v", n, err)
+				}
+			}
+			if err := p.Flush(); err != nil {
+				t.Errorf("Flush() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("PrefixWriter got = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleColor(t *testing.T) {
+	if RuleColor(0).Equals(RuleColor(1)) {
+		t.Errorf("RuleColor() neighbouring rules share a color")
+	}
+	if !RuleColor(0).Equals(RuleColor(len(ruleColors))) {
+		t.Errorf("RuleColor() does not wrap around")
+	}
+}
@@ -0,0 +1,47 @@
+//go:build !linux
+
+/*
+ * Copyright (c) 2024. Christopher Stillson <stillson@gmail.com>
+ *
+ * Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+ *
+ * Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+ * Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+ * Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+ * THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+ */
+
+package termui
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoPty = errors.New("pseudo terminals are not supported on this platform")
+
+// IsTerminal reports whether f is a terminal.
+func IsTerminal(_ *os.File) bool {
+	return false
+}
+
+// OpenPty opens a new pseudo terminal, returning its master and slave sides.
+func OpenPty() (*os.File, *os.File, error) {
+	return nil, nil, errNoPty
+}
+
+// MakeRaw puts the terminal f into raw mode, and returns a function
+// putting it back the way it was.
+func MakeRaw(_ *os.File) (func(), error) {
+	return nil, errNoPty
+}
+
+// CopyWinsize sets the window size of the terminal to that of from.
+func CopyWinsize(_ *os.File, _ *os.File) error {
+	return errNoPty
+}
+
+// WaitReadable waits up to timeoutMs milliseconds for f to have input.
+func WaitReadable(_ *os.File, _ int) (bool, error) {
+	return false, errNoPty
+}